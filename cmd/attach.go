@@ -1,27 +1,106 @@
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/rot1024/tuck/session"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	attachReadOnly       bool
+	attachConnectTimeout time.Duration
+	attachReplay         string
+	attachNew            bool
+	attachDetachAfter    time.Duration
+	attachSocket         string
+	attachForce          bool
+	attachQuietAttach    bool
+	attachQuietExit      bool
+	attachQuietDetach    bool
+	attachPrintSize      bool
+	attachReconnect      bool
+	attachControl        bool
+	attachReportCwd      bool
+	attachNoReplay       bool
 )
 
 var attachCmd = &cobra.Command{
-	Use:     "attach [name]",
+	Use:     "attach [name] [-- command...]",
 	Aliases: []string{"a"},
 	Short:   "Attach to an existing session",
 	Long: `Attach to an existing session with the given name.
 If no name is specified, attaches to the most recently active session.
+Use tcp://host:port to attach to a session created with --listen.
 
-Use ~. (default) or configured detach key to detach.`,
-	Args: cobra.MaximumNArgs(1),
+Use ~. (default) or configured detach key to detach.
+With --read-only, input is ignored and only the detach key works.
+With --replay screen, only about the last screenful of earlier output is
+shown instead of the whole buffer (--replay none, or --no-replay, shows
+nothing but new output).
+With --new, the session is created if it doesn't exist, running the given
+command (or the default shell); an existing session is attached as usual
+and the command is ignored.
+With --socket, the session listening on the given socket path is attached
+instead of one found by name (e.g. one in another data directory).
+With --force, every other client attached to the session is detached
+(like tmux's attach -d), so the session is sized for this terminal alone.
+With --reconnect, a lost connection (e.g. the session's server restarted)
+is retried for about ten seconds, and output carries on where it left off.
+With --print-size, nothing is attached: the session's terminal size and
+attached clients are printed as "COLS ROWS CLIENTS" (before any client
+has attached, the size it was created with: the creating terminal's or
+--size, or 0 0 with neither), e.g. for formatting input sent with
+"tuck send-keys".
+With --control, output and commands go over stdout and stdin as lines of
+a text protocol modelled on tmux's control mode (%output, %exit, send-keys,
+refresh-client -C, detach-client), for editors and other programs.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if attachPrintSize && (attachNew || attachSocket != "") {
+			return fmt.Errorf("--print-size cannot be used with --new or --socket")
+		}
+		if attachNoReplay && cmd.Flags().Changed("replay") && attachReplay != "none" {
+			return fmt.Errorf("--no-replay and --replay %s cannot be used together", attachReplay)
+		}
+		if attachControl && (attachNew || attachPrintSize) {
+			return fmt.Errorf("--control cannot be used with --new or --print-size")
+		}
+		if attachSocket != "" {
+			if attachNew {
+				return fmt.Errorf("--socket and --new cannot be used together")
+			}
+			return cobra.NoArgs(cmd, args)
+		}
+		if attachNew {
+			return cobra.MinimumNArgs(1)(cmd, args)
+		}
+		// Flag parsing stops at the name, for the command --new takes
+		if len(args) > 1 && strings.HasPrefix(args[1], "-") && args[1] != "--" {
+			return fmt.Errorf("flags must come before the session name: %s", args[1])
+		}
+		return cobra.MaximumNArgs(1)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		checkNotNested()
+		// Neither needs a terminal of its own, so they work inside a session
+		if !attachPrintSize && !attachControl {
+			checkNotNested()
+		}
+
+		if attachNew && !session.IsRemote(args[0]) && !session.Exists(args[0]) {
+			createAndAttachSession(args[0], commandArgs(args[1:]))
+			return
+		}
 
 		var name string
-		if len(args) == 0 {
+		if attachSocket != "" {
+			name = session.SocketName(attachSocket)
+		} else if len(args) == 0 {
 			// Attach to most recent session
 			s, err := session.MostRecent()
 			if err != nil {
@@ -35,18 +114,121 @@ Use ~. (default) or configured detach key to detach.`,
 			name = s.Name
 		} else {
 			name = args[0]
-			if !session.Exists(name) {
-				fmt.Fprintf(os.Stderr, "Error: session %q does not exist\n", name)
+			if !session.IsRemote(name) && !session.Exists(name) {
+				if session.Stale(name) {
+					fmt.Fprintf(os.Stderr, "Error: session %q: %v\n", name, session.ErrStaleSocket)
+					offerStaleCleanup(name)
+				} else {
+					fmt.Fprintf(os.Stderr, "Error: session %q does not exist\n", name)
+				}
+				os.Exit(1)
+			}
+		}
+
+		if attachPrintSize {
+			printSize(name)
+			return
+		}
+
+		if attachNoReplay {
+			attachReplay = "none"
+		}
+		replay, err := session.ParseReplayMode(attachReplay)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if attachControl {
+			code, err := session.Control(name, session.ControlOptions{
+				ReadOnly:       attachReadOnly,
+				ConnectTimeout: attachConnectTimeout,
+				Replay:         replay,
+				Socket:         attachSocket,
+			}, os.Stdin, os.Stdout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
+			// Like attach, exit with the command's status if it ended
+			if code < 0 || code > 255 {
+				code = 1
+			}
+			os.Exit(code)
 		}
 
 		if err := session.Attach(name, session.AttachOptions{
-			Quiet:      quietFlag,
-			DetachKeys: mustGetDetachKeys(),
+			Quiet:            quietFlag,
+			SuppressAttached: attachQuietAttach,
+			SuppressExit:     attachQuietExit,
+			SuppressDetach:   attachQuietDetach,
+			DetachKeys:       mustGetDetachKeys(),
+			SuspendKey:       mustGetSuspendKey(),
+			EscapeActions:    mustGetEscapeActions(),
+			Compress:         compressFlag,
+			NoTitle:          noTitleFlag,
+			ReadOnly:         attachReadOnly,
+			ConnectTimeout:   attachConnectTimeout,
+			Replay:           replay,
+			DetachAfter:      attachDetachAfter,
+			Socket:           attachSocket,
+			Takeover:         attachForce,
+			Reconnect:        attachReconnect,
+			ReportCwd:        attachReportCwd,
 		}); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			if errors.Is(err, session.ErrStaleSocket) && attachSocket == "" {
+				offerStaleCleanup(name)
+			}
+			if errors.Is(err, session.ErrNotTerminal) && attachSocket == "" {
+				fmt.Fprintf(os.Stderr, "Use \"tuck logs -f %s\" to follow its output instead\n", name)
+			}
 			os.Exit(1)
 		}
 	},
 }
+
+// printSize prints a session's terminal size and attached clients
+func printSize(name string) {
+	st, err := session.Query(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d %d %d\n", st.Cols, st.Rows, st.Clients)
+}
+
+// offerStaleCleanup asks whether to remove a session whose server is gone
+func offerStaleCleanup(name string) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintf(os.Stderr, "Run \"tuck delete %s\" to clean it up\n", name)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Remove stale session %q? [y/N] ", name)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		_ = session.Remove(name)
+		if !quietFlag {
+			fmt.Fprintf(os.Stderr, "Session %q removed\n", name)
+		}
+	}
+}
+
+func init() {
+	attachCmd.Flags().DurationVar(&attachConnectTimeout, "connect-timeout", session.DefaultConnectTimeout, "How long to keep retrying the connection")
+	attachCmd.Flags().StringVar(&attachReplay, "replay", "full", "Earlier output to show on attach: full, screen or none")
+	attachCmd.Flags().BoolVar(&attachNoReplay, "no-replay", false, "Show only new output, not the session's earlier output (same as --replay none)")
+	attachCmd.Flags().DurationVar(&attachDetachAfter, "detach-after", 0, "Detach automatically after this long (e.g., 30s)")
+	attachCmd.Flags().BoolVarP(&attachNew, "new", "n", false, "Create the session if it doesn't exist")
+	attachCmd.Flags().StringVar(&attachSocket, "socket", "", "Attach to the session listening on this socket path")
+	attachCmd.Flags().BoolVar(&attachQuietAttach, "quiet-attach", false, "Don't show the \"attached\" message")
+	attachCmd.Flags().BoolVar(&attachQuietExit, "quiet-exit", false, "Don't show the \"ended\" message when the session's command exits")
+	attachCmd.Flags().BoolVar(&attachQuietDetach, "quiet-detach", false, "Don't show the \"detached\" message")
+	attachCmd.Flags().BoolVarP(&attachForce, "force", "f", false, "Detach other clients attached to the session")
+	attachCmd.Flags().BoolVarP(&attachReadOnly, "read-only", "r", false, "Attach without sending input or resizing the session")
+	attachCmd.Flags().BoolVar(&attachReconnect, "reconnect", false, "Connect again if the connection to the session is lost")
+	attachCmd.Flags().BoolVar(&attachReportCwd, "report-cwd", false, "Tell the terminal the session's working directory (OSC 7), e.g. for opening new tabs there")
+	attachCmd.Flags().BoolVar(&attachControl, "control", false, "Talk a text protocol over stdin and stdout instead of attaching the terminal (like tmux -C)")
+	attachCmd.Flags().BoolVar(&attachPrintSize, "print-size", false, "Print the session's size and client count (COLS ROWS CLIENTS) instead of attaching")
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rot1024/tuck/session"
+	"github.com/spf13/cobra"
+)
+
+var (
+	captureRaw   bool
+	capturePlain bool
+)
+
+var captureCmd = &cobra.Command{
+	Use:   "capture <name>",
+	Short: "Print a session's recent output without attaching",
+	Long: `Print the output that would be replayed when attaching to a session,
+then exit. Escape sequences are stripped for readability unless --raw is given.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeSessionName,
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		out, err := session.Capture(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if capturePlain && !captureRaw {
+			out = session.StripANSI(out)
+		}
+		if _, err := os.Stdout.Write(out); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	captureCmd.Flags().BoolVar(&capturePlain, "plain", true, "Strip escape sequences")
+	captureCmd.Flags().BoolVar(&captureRaw, "raw", false, "Keep escape sequences (same as --plain=false)")
+}
@@ -3,43 +3,56 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"slices"
 	"syscall"
 
 	"github.com/rot1024/tuck/session"
 	"github.com/spf13/cobra"
 )
 
+var clearGroup string
+
 var clearCmd = &cobra.Command{
 	Use:   "clear",
 	Short: "Delete all sessions",
-	Long:  `Delete all sessions. This will terminate all running processes.`,
-	Args:  cobra.NoArgs,
+	Long: `Delete all sessions. This will terminate all running processes.
+With --group, only the sessions in that group are deleted.`,
+	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		sessions, err := session.List()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+		if clearGroup != "" {
+			sessions = slices.DeleteFunc(sessions, func(s *session.Session) bool {
+				return s.Group != clearGroup
+			})
+		}
 
 		if len(sessions) == 0 {
-			fmt.Println("No sessions to clear")
+			if !quietFlag {
+				fmt.Println("No sessions to clear")
+			}
 			return
 		}
 
 		for _, sess := range sessions {
-			// Kill the server process
-			if sess.PID > 0 {
-				proc, err := os.FindProcess(sess.PID)
-				if err == nil {
-					_ = proc.Signal(syscall.SIGTERM)
-				}
-			}
+			// Stop the server (exited sessions have nothing to stop)
+			_ = session.Signal(sess.Name, syscall.SIGTERM)
 
 			// Remove session files
+			if removeLogFlag {
+				_ = session.RemoveLog(sess.Name)
+			}
 			_ = session.Remove(sess.Name)
-			fmt.Printf("Session %q deleted\n", sess.Name)
+			if !quietFlag {
+				fmt.Printf("Session %q deleted\n", sess.Name)
+			}
 		}
 
-		fmt.Printf("Cleared %d session(s)\n", len(sessions))
+		if !quietFlag {
+			fmt.Printf("Cleared %d session(s)\n", len(sessions))
+		}
 	},
 }
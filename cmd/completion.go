@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/rot1024/tuck/session"
+	"github.com/spf13/cobra"
+)
+
+// completeSessionName completes the first argument with the names of live sessions
+func completeSessionName(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	sessions, err := session.List()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var names []string
+	for _, s := range sessions {
+		if s.Exited() || !strings.HasPrefix(s.Name, toComplete) {
+			continue
+		}
+		names = append(names, s.Name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func init() {
+	for _, c := range []*cobra.Command{attachCmd, deleteCmd, killCmd, renameCmd, sendCmd, logsCmd, infoCmd} {
+		c.ValidArgsFunction = completeSessionName
+	}
+}
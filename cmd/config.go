@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+)
+
+// config holds defaults from the config file.
+// Precedence: flags > environment variables > config file > built-in defaults.
+type config struct {
+	DetachKeys []string `toml:"detach_keys"` // e.g. ["~.", "ctrl-a"]
+	SuspendKey string   `toml:"suspend_key"` // e.g. "ctrl-z"
+	Quiet      bool     `toml:"quiet"`
+	NoTitle    bool     `toml:"no_title"`    // Don't set the terminal title on attach
+	BufferSize string   `toml:"buffer_size"` // e.g. "4M"
+	Shell      string   `toml:"shell"`       // Used when no command is given, and for --shell
+	NameScheme string   `toml:"name_scheme"` // Scheme for generated session names (dir, timestamp, random)
+	ReportCwd  bool     `toml:"report_cwd"`  // Tell the terminal the session's directory (OSC 7) on attach
+
+	NotifyCommand string   `toml:"notify_command"` // Run by "tuck wait" when a session ends
+	EscapeActions []string `toml:"escape_actions"` // e.g. ["x=kill", "k=none"]
+}
+
+// cfg is the loaded config (zero value if there is no config file)
+var cfg config
+
+// configPath returns the config file path ($TUCK_CONFIG or <user config dir>/tuck/config.toml)
+func configPath() (string, error) {
+	if p := os.Getenv("TUCK_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %w", err)
+	}
+	return filepath.Join(dir, "tuck", "config.toml"), nil
+}
+
+// loadConfig reads the config file; a missing file is not an error
+func loadConfig() (config, error) {
+	var c config
+	path, err := configPath()
+	if err != nil {
+		return c, err
+	}
+	if _, err := toml.DecodeFile(path, &c); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return config{}, nil
+		}
+		return config{}, fmt.Errorf("failed to load config %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// applyConfig loads the config file and fills in flags that weren't set explicitly
+func applyConfig(cmd *cobra.Command) {
+	c, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	cfg = c
+
+	flags := cmd.Flags()
+	if !flags.Changed("quiet") && cfg.Quiet {
+		quietFlag = true
+	}
+	if !flags.Changed("no-title") && cfg.NoTitle {
+		noTitleFlag = true
+	}
+	if !flags.Changed("report-cwd") && cfg.ReportCwd {
+		attachReportCwd = true
+	}
+	if !flags.Changed("buffer-size") {
+		bufferSizeFlag = cfg.BufferSize
+	}
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"syscall"
@@ -18,22 +19,20 @@ var deleteCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		name := args[0]
 
-		sess, err := session.Load(name)
-		if err != nil {
+		// Stop the server; a stale socket without session info has no process to stop
+		err := session.Signal(name, syscall.SIGTERM)
+		if errors.Is(err, session.ErrNotExist) && !session.Exists(name) && !session.Stale(name) {
 			fmt.Fprintf(os.Stderr, "Error: session %q does not exist\n", name)
 			os.Exit(1)
 		}
 
-		// Kill the server process
-		if sess.PID > 0 {
-			proc, err := os.FindProcess(sess.PID)
-			if err == nil {
-				_ = proc.Signal(syscall.SIGTERM)
-			}
-		}
-
 		// Remove session files
+		if removeLogFlag {
+			_ = session.RemoveLog(name)
+		}
 		_ = session.Remove(name)
-		fmt.Printf("Session %q deleted\n", name)
+		if !quietFlag {
+			fmt.Printf("Session %q deleted\n", name)
+		}
 	},
 }
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rot1024/tuck/session"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the environment for problems",
+	Long: `Check what tuck needs to run sessions: a writable data directory,
+pseudo-terminals, $TERM and a shell. Sockets left behind by crashed
+servers are listed too. Each problem comes with a suggested fix, and the
+exit status is 1 if anything would keep sessions from working.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		failed := false
+		pass := func(format string, a ...any) {
+			fmt.Printf("✅ "+format+"\n", a...)
+		}
+		warn := func(fix, format string, a ...any) {
+			fmt.Printf("⚠️  "+format+"\n", a...)
+			fmt.Printf("   → %s\n", fix)
+		}
+		fail := func(fix, format string, a ...any) {
+			fmt.Printf("❌ "+format+"\n", a...)
+			fmt.Printf("   → %s\n", fix)
+			failed = true
+		}
+
+		dir, err := session.CheckDataDir()
+		if err != nil {
+			fail("check the directory's permissions, or set TUCK_DATA_DIR to a writable directory",
+				"%v", err)
+		} else {
+			pass("data directory %s is writable", dir)
+		}
+
+		if err := session.CheckPTY(); err != nil {
+			fail("make sure /dev/ptmx and /dev/pts are available (in containers, don't replace /dev)",
+				"can't allocate a pseudo-terminal: %v", err)
+		} else {
+			pass("pseudo-terminals can be allocated")
+		}
+
+		if term := os.Getenv("TERM"); term == "" {
+			warn("set TERM for your terminal, e.g. export TERM=xterm-256color",
+				"$TERM is not set (sessions get %s)", session.DefaultTerm)
+		} else {
+			pass("$TERM is %s", term)
+		}
+
+		if shell, err := session.ResolveShell(cfg.Shell); err != nil {
+			fail("set SHELL (or TUCK_SHELL, or shell in the config file) to an installed shell",
+				"no shell for sessions: %v", err)
+		} else if os.Getenv("SHELL") == "" && os.Getenv("TUCK_SHELL") == "" && cfg.Shell == "" {
+			warn("set SHELL to your shell, e.g. export SHELL=/bin/bash",
+				"$SHELL is not set (sessions run %s)", shell)
+		} else {
+			pass("sessions run %s", shell)
+		}
+
+		stale, err := staleSessions()
+		switch {
+		case err != nil:
+			fail("check the data directory's permissions", "can't list sessions: %v", err)
+		case len(stale) > 0:
+			warn("run \"tuck prune\" to clean them up",
+				"stale sockets of crashed servers: %s", strings.Join(stale, ", "))
+		default:
+			pass("no stale sockets")
+		}
+
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// staleSessions returns the names of sessions whose socket nobody listens on
+func staleSessions() ([]string, error) {
+	dir, err := session.DataDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var stale []string
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".sock" {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ".sock")
+		if session.Stale(name) {
+			stale = append(stale, name)
+		}
+	}
+	return stale, nil
+}
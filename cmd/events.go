@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/rot1024/tuck/session"
+	"github.com/spf13/cobra"
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Follow session lifecycle events as JSON lines",
+	Long: `Print one JSON object per line for each session event, as it happens:
+created, exited, attached and detached. Runs until interrupted.
+
+Example:
+  {"time":"2025-01-01T12:00:00Z","event":"exited","session":"build","exit_code":0}`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		enc := json.NewEncoder(os.Stdout)
+		err := session.FollowEvents(func(ev session.Event) bool {
+			return enc.Encode(ev) == nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
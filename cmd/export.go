@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/rot1024/tuck/session"
+	"github.com/spf13/cobra"
+)
+
+var exportPlain bool
+
+var exportCmd = &cobra.Command{
+	Use:   "export <name> <out.cast>",
+	Short: "Export a session recording as an asciinema cast",
+	Long: `Export the output recorded with --record as an asciinema v2 cast file.
+The session may still be running or may have already ended.
+
+With --plain, the output is written as plain text without escape sequences.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		name, outPath := args[0], args[1]
+
+		recordPath, err := session.RecordPath(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		// Terminal size defaults to 80x24 if the session is gone or never resized
+		width, height := 80, 24
+		if sess, err := session.Load(name); err == nil {
+			if sess.RecordPath != "" {
+				recordPath = sess.RecordPath
+			}
+			if sess.Rows > 0 && sess.Cols > 0 {
+				width, height = int(sess.Cols), int(sess.Rows)
+			}
+		}
+
+		in, err := os.Open(recordPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: no recording for session %q (create it with --record)\n", name)
+			os.Exit(1)
+		}
+		defer func() { _ = in.Close() }()
+
+		out, err := os.Create(outPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if exportPlain {
+			err = writePlain(out, bufio.NewReader(in))
+		} else {
+			err = writeCast(out, bufio.NewReader(in), width, height)
+		}
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !quietFlag {
+			fmt.Printf("Session %q exported to %s\n", name, outPath)
+		}
+	},
+}
+
+// writeCast converts recorded frames into an asciinema v2 cast. The size
+// recorded before the first output goes in the header (width and height
+// are used if there is none, as in older recordings), and later size
+// changes become resize events.
+func writeCast(w io.Writer, r io.Reader, width, height int) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+
+	var start float64
+	var pending []byte // Incomplete UTF-8 sequence carried over to the next frame
+	var last float64
+	started := false
+	headerWritten := false
+
+	for {
+		frame, err := session.ReadFrame(r)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// A truncated final frame means the server is still writing; stop there
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read recording: %w", err)
+		}
+
+		t := float64(frame.Time.UnixNano()) / 1e9
+		if !started {
+			start = t
+			started = true
+		}
+		if frame.IsResize() && !headerWritten {
+			width, height = int(frame.Cols), int(frame.Rows)
+			continue
+		}
+		if !headerWritten {
+			if err := enc.Encode(map[string]any{
+				"version":   2,
+				"width":     width,
+				"height":    height,
+				"timestamp": int64(start),
+			}); err != nil {
+				return err
+			}
+			headerWritten = true
+		}
+
+		last = t - start
+		if frame.IsResize() {
+			if err := enc.Encode([]any{last, "r", fmt.Sprintf("%dx%d", frame.Cols, frame.Rows)}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		data := append(pending, frame.Data...)
+		n := utf8Boundary(data)
+		pending = append([]byte(nil), data[n:]...)
+		if n == 0 {
+			continue
+		}
+		if err := enc.Encode([]any{last, "o", string(data[:n])}); err != nil {
+			return err
+		}
+	}
+
+	if !headerWritten {
+		return fmt.Errorf("recording is empty")
+	}
+	if len(pending) > 0 {
+		if err := enc.Encode([]any{last, "o", string(pending)}); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// writePlain writes recorded output as plain text
+func writePlain(w io.Writer, r io.Reader) error {
+	// Escape sequences may be split across frames, so strip the output as a whole
+	var data []byte
+	for {
+		frame, err := session.ReadFrame(r)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read recording: %w", err)
+		}
+		data = append(data, frame.Data...)
+	}
+	_, err := w.Write(session.StripANSI(data))
+	return err
+}
+
+// utf8Boundary returns the length of the longest prefix of b that doesn't
+// end in the middle of a multibyte UTF-8 sequence
+func utf8Boundary(b []byte) int {
+	// A UTF-8 sequence is at most 4 bytes, so only the last 3 can be incomplete
+	for i := len(b) - 1; i >= 0 && i >= len(b)-3; i-- {
+		c := b[i]
+		if c < 0x80 {
+			return len(b)
+		}
+		if c >= 0xC0 {
+			// Leading byte: complete if the whole sequence is present
+			if utf8.FullRune(b[i:]) {
+				return len(b)
+			}
+			return i
+		}
+	}
+	return len(b)
+}
+
+func init() {
+	exportCmd.Flags().BoolVar(&exportPlain, "plain", false, "Write plain text instead of an asciinema cast")
+}
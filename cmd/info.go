@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rot1024/tuck/session"
+	"github.com/spf13/cobra"
+)
+
+var infoJSON bool
+
+var infoCmd = &cobra.Command{
+	Use:   "info <name>",
+	Short: "Show a running session's live state",
+	Long: `Ask a running session's server for its live state without attaching:
+attached clients, terminal size, creation time, last activity and uptime.
+Use --json for dashboards and scripts.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		st, err := session.Query(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if infoJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(st); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		size := "-"
+		if st.Rows > 0 && st.Cols > 0 {
+			size = fmt.Sprintf("%dx%d", st.Cols, st.Rows)
+		}
+		fmt.Printf("name\t%s\n", st.Name)
+		fmt.Printf("pid\t%d\n", st.PID)
+		fmt.Printf("clients\t%d\n", st.Clients)
+		fmt.Printf("size\t%s\n", size)
+		if st.Cwd != "" {
+			fmt.Printf("cwd\t%s\n", st.Cwd)
+		}
+		fmt.Printf("created\t%s\n", formatRelativeTime(st.CreatedAt))
+		fmt.Printf("active\t%s\n", formatRelativeTime(st.LastActive))
+		fmt.Printf("uptime\t%s\n", time.Since(st.CreatedAt).Round(time.Second))
+	},
+}
+
+func init() {
+	infoCmd.Flags().BoolVar(&infoJSON, "json", false, "Print the state as JSON")
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rot1024/tuck/session"
+	"github.com/spf13/cobra"
+)
+
+var killCmd = &cobra.Command{
+	Use:   "kill <name>",
+	Short: "End a session gracefully",
+	Long: `End a session's command as if its terminal was closed, then delete the session.
+
+The command and the job running in it get SIGHUP, then SIGTERM and
+finally SIGKILL if they keep running. Unlike delete, this waits until
+the command has exited before removing the session.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		// Kill removes the session info, which says where the logs are
+		var logPaths []string
+		if removeLogFlag {
+			logPaths, _ = session.LogPaths(name)
+		}
+		if err := session.Kill(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		// Removed only now, as the server writes them until it exits
+		_ = session.RemoveLogFiles(logPaths)
+		if !quietFlag {
+			fmt.Printf("Session %q killed\n", name)
+		}
+	},
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/rot1024/tuck/session"
+)
+
+func TestKillRemovesLogFile(t *testing.T) {
+	t.Setenv("TUCK_DATA_DIR", t.TempDir())
+	logPath := filepath.Join(t.TempDir(), "custom.log")
+	if err := os.WriteFile(logPath, []byte("output\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stands in for the session's server, which Kill signals and waits for
+	server := exec.Command("sleep", "60")
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// Reaped as soon as it exits, so Kill doesn't wait for a zombie
+	go func() { _ = server.Wait() }()
+	t.Cleanup(func() { _ = server.Process.Kill() })
+	sess := &session.Session{Name: "work", PID: server.Process.Pid, LogPath: logPath}
+	if err := sess.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	removeLogFlag, quietFlag = true, true
+	t.Cleanup(func() { removeLogFlag, quietFlag = false, false })
+	killCmd.Run(killCmd, []string{"work"})
+
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Errorf("log file given with --log-file left behind after kill --log (stat error = %v)", err)
+	}
+	if _, err := session.Load("work"); err == nil {
+		t.Error("session info left behind after kill")
+	}
+}
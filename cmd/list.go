@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -10,6 +13,22 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var (
+	listJSON    bool
+	listFilters []string
+	listGroup   string
+	listSort    string
+)
+
+// listEntry is a session as emitted by "tuck list --json"
+type listEntry struct {
+	*session.Session
+	Alive         bool   `json:"alive"`
+	Error         string `json:"error,omitempty"` // Why the session ended, if it failed
+	LastActiveAgo string `json:"last_active_ago"`
+	CreatedAgo    string `json:"created_ago"`
+}
+
 var listCmd = &cobra.Command{
 	Use:     "list",
 	Aliases: []string{"ls"},
@@ -20,9 +39,29 @@ var listCmd = &cobra.Command{
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+		filters := listFilters
+		if listGroup != "" {
+			filters = append(filters, "group="+listGroup)
+		}
+		sessions, err = filterSessions(sessions, filters)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := session.SortSessions(sessions, listSort); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if listJSON {
+			printListJSON(sessions)
+			return
+		}
 
 		if len(sessions) == 0 {
-			fmt.Println("No sessions")
+			if !quietFlag {
+				fmt.Println("No sessions")
+			}
 			return
 		}
 
@@ -31,11 +70,111 @@ var listCmd = &cobra.Command{
 			if cmdStr == "" {
 				cmdStr = "(default shell)"
 			}
-			fmt.Printf("%s\t%s\t%s\n", s.Name, formatRelativeTime(s.LastActive), cmdStr)
+			name := s.Name
+			if s.Exited() {
+				name = fmt.Sprintf("%s (exited %d)", s.Name, *s.ExitCode)
+				if msg := session.ReadError(s.Name); msg != "" {
+					name = fmt.Sprintf("%s (exited %d: %s)", s.Name, *s.ExitCode, msg)
+				}
+			} else if s.IdleTimeout > 0 {
+				name = fmt.Sprintf("%s (idle timeout %s)", s.Name, s.IdleTimeout)
+			}
+			if s.Restarts > 0 {
+				name = fmt.Sprintf("%s (restarted %d times)", name, s.Restarts)
+			}
+			if s.Group != "" {
+				name = fmt.Sprintf("%s @%s", name, s.Group)
+			}
+			if len(s.Tags) > 0 {
+				name = fmt.Sprintf("%s [%s]", name, strings.Join(s.Tags, ","))
+			}
+			fmt.Printf("%s\tactive %s\tcreated %s\t%s\t%s\n", name,
+				formatRelativeTime(s.LastActive), formatRelativeTime(s.CreatedAt), cmdStr, formatDir(s.Dir))
 		}
 	},
 }
 
+// printListJSON prints sessions as a JSON array (never null)
+func printListJSON(sessions []*session.Session) {
+	entries := make([]listEntry, 0, len(sessions))
+	for _, s := range sessions {
+		// Keep the token out of output that may be pasted or logged
+		sess := *s
+		sess.Token = ""
+		var errMsg string
+		if s.Exited() {
+			errMsg = session.ReadError(s.Name)
+		}
+		entries = append(entries, listEntry{
+			Session:       &sess,
+			Alive:         !s.Exited(),
+			Error:         errMsg,
+			LastActiveAgo: formatRelativeTime(s.LastActive),
+			CreatedAgo:    formatRelativeTime(s.CreatedAt),
+		})
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(entries); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// filterSessions keeps the sessions matching every filter.
+// Filters are "tag=TAG", "group=GROUP" (exact) or "name=SUBSTR".
+func filterSessions(sessions []*session.Session, filters []string) ([]*session.Session, error) {
+	type filter struct{ key, value string }
+	var parsed []filter
+	for _, f := range filters {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || (key != "tag" && key != "group" && key != "name") {
+			return nil, fmt.Errorf("invalid filter: %q (use tag=TAG, group=GROUP or name=SUBSTR)", f)
+		}
+		parsed = append(parsed, filter{key, value})
+	}
+
+	var matched []*session.Session
+	for _, s := range sessions {
+		ok := true
+		for _, f := range parsed {
+			switch f.key {
+			case "tag":
+				ok = slices.Contains(s.Tags, f.value)
+			case "group":
+				ok = s.Group == f.value
+			case "name":
+				ok = strings.Contains(s.Name, f.value)
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, s)
+		}
+	}
+	return matched, nil
+}
+
+// formatDir shortens a directory for display, using ~ for the home directory
+func formatDir(dir string) string {
+	if dir == "" {
+		return "-"
+	}
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" || home == "/" {
+		return dir
+	}
+	if dir == home {
+		return "~"
+	}
+	if rel, ok := strings.CutPrefix(dir, home+string(filepath.Separator)); ok {
+		return filepath.Join("~", rel)
+	}
+	return dir
+}
+
 func formatRelativeTime(t time.Time) string {
 	if t.IsZero() {
 		return "-"
@@ -52,3 +191,10 @@ func formatRelativeTime(t time.Time) string {
 		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
 	}
 }
+
+func init() {
+	listCmd.Flags().BoolVar(&listJSON, "json", false, "Output sessions as JSON")
+	listCmd.Flags().StringArrayVar(&listFilters, "filter", nil, "Only list matching sessions (tag=TAG, group=GROUP or name=SUBSTR). Can be specified multiple times")
+	listCmd.Flags().StringVar(&listGroup, "group", "", "Only list sessions in this group")
+	listCmd.Flags().StringVar(&listSort, "sort", session.SortRecent, "Order sessions by recent (activity), created or name")
+}
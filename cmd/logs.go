@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rot1024/tuck/session"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var logsFollow bool
+
+var logsCmd = &cobra.Command{
+	Use:   "logs <name>",
+	Short: "Print a session's output, optionally following it",
+	Long: `Print the output that would be replayed when attaching to a session.
+With -f, keep printing new output until the session ends or Ctrl+C is
+pressed, like tail -f. Nothing typed is sent to the session, so it's safe
+for watching a build from another terminal.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		if !logsFollow {
+			out, err := session.Capture(name)
+			if err == nil {
+				_, err = os.Stdout.Write(out)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		// The session's program may have hidden the cursor or left colors
+		// on; undo that when interrupted so the shell prompt looks right
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-sigs
+			if term.IsTerminal(int(os.Stdout.Fd())) {
+				fmt.Print("\x1b[0m\x1b[?25h\r\n")
+			}
+			os.Exit(0)
+		}()
+
+		if err := session.Follow(name, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Keep printing new output until the session ends")
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rot1024/tuck/session"
+	"github.com/spf13/cobra"
+)
+
+var moveCmd = &cobra.Command{
+	Use:   "move <name> <dir>",
+	Short: "Change the directory shown for a session",
+	Long: `Change the working directory recorded for a session, as shown by
+"tuck list" (e.g. after moving the project it runs in).
+Only the label changes: the session keeps running, and its command stays
+in the directory it was started in.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		name, dir := args[0], args[1]
+
+		if err := session.Move(name, dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !quietFlag {
+			fmt.Printf("Session %q moved to %s\n", name, dir)
+		}
+	},
+}
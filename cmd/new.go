@@ -1,29 +1,43 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/rot1024/tuck/session"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var newCmd = &cobra.Command{
 	Use:     "new [command...]",
 	Aliases: []string{"n"},
 	Short:   "Create a new session with auto-generated name",
-	Long: `Create a new session with an auto-generated name based on current directory.
+	Long: `Create a new session with an auto-generated name, or the one given with
+--name (like "tuck create"). Names are based on the current directory by
+default; --scheme (or $TUCK_NAME_SCHEME) selects another scheme:
+
+  dir        current directory name, e.g. myproject, myproject-1
+  timestamp  creation time, e.g. 20240101-153000
+  random     adjective-noun pair, e.g. brave-otter
 If no command is specified, the default shell is used.
 
 After creating the session, you will be automatically attached to it.
 Use ~. (default) or configured detach key to detach.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		checkNotNested()
-		name := generateSessionName()
+		name := nameFlag
+		if name == "" {
+			name = session.GenerateName(nameScheme())
+		}
 		createAndAttachSession(name, args)
 	},
 }
@@ -35,30 +49,47 @@ var createCmd = &cobra.Command{
 	Long: `Create a new session with the specified name and command.
 If no command is specified, the default shell is used.
 
+Flags go before the name: everything after it is the command, as it is
+(e.g. "tuck create job -- kubectl logs -f pod"; the -- is optional).
+
 After creating the session, you will be automatically attached to it.
 Use ~. (default) or configured detach key to detach.`,
 	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		checkNotNested()
 		name := args[0]
-		command := args[1:]
+		command := commandArgs(args[1:])
 		createAndAttachSession(name, command)
 	},
 }
 
 func createAndAttachSession(name string, command []string) {
-	if session.Exists(name) {
-		fmt.Fprintf(os.Stderr, "Error: session %q already exists\n", name)
+	if err := session.ValidateName(name); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Fork to create server process
 	if os.Getenv("TUCK_SERVER") == "1" {
-		// We are the server process
+		// We are the server process; NewServer checks the name under a lock
 		runServer(name, command)
 		return
 	}
 
+	// Checked before Exists, which would clean up a session whose server
+	// died without cleaning up (e.g. in a crash); it is only replaced with --force
+	if session.Dead(name) {
+		if !forceFlag {
+			fmt.Fprintf(os.Stderr, "Error: session %q already exists, but its server is no longer running (use --force to replace it)\n", name)
+			os.Exit(1)
+		}
+		_ = session.Remove(name)
+	}
+	if session.Exists(name) {
+		fmt.Fprintf(os.Stderr, "Error: session %q already exists\n", name)
+		os.Exit(1)
+	}
+
 	// Start server process in background
 	exe, err := os.Executable()
 	if err != nil {
@@ -66,7 +97,126 @@ func createAndAttachSession(name string, command []string) {
 		os.Exit(1)
 	}
 
-	serverArgs := append([]string{"create", name}, command...)
+	logPath, err := resolveLogPath(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// The server couldn't even leave its error file behind
+	if _, err := session.CheckDataDir(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// Validate here so the error isn't lost in the background server
+	if _, err := parseSize(bufferSizeFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(command) == 0 || viaShellFlag {
+		if _, err := session.ResolveShell(cfg.Shell); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	dir, err := resolveDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateEnv(envFlags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if groupFlag != "" && !isWord(groupFlag) {
+		fmt.Fprintf(os.Stderr, "Error: invalid group: %q (groups can't contain commas or spaces)\n", groupFlag)
+		os.Exit(1)
+	}
+	if err := validateTags(tagFlags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := validateRestart(restartFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	listenAddr, err := parseListenAddr(listenFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// Start the command at this terminal's size; the server can't see it
+	winSize := winSizeFlag
+	if winSize == "" {
+		if cols, rows, err := term.GetSize(int(os.Stdin.Fd())); err == nil && cols > 0 && rows > 0 {
+			winSize = fmt.Sprintf("%dx%d", cols, rows)
+		}
+	}
+	if _, _, err := parseWinSize(winSize); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	serverArgs := []string{"create"}
+	if logPath != "" {
+		serverArgs = append(serverArgs, "--log-file", logPath)
+	}
+	if logNormalizeFlag {
+		serverArgs = append(serverArgs, "--log-normalize")
+	}
+	if recordFlag {
+		serverArgs = append(serverArgs, "--record")
+	}
+	if idleTimeoutFlag > 0 {
+		serverArgs = append(serverArgs, "--idle-timeout", idleTimeoutFlag.String())
+	}
+	if winSize != "" {
+		serverArgs = append(serverArgs, "--size", winSize)
+	}
+	if widthFlag > 0 {
+		serverArgs = append(serverArgs, "--width", strconv.Itoa(int(widthFlag)))
+	}
+	if heightFlag > 0 {
+		serverArgs = append(serverArgs, "--height", strconv.Itoa(int(heightFlag)))
+	}
+	if writeTimeoutFlag != session.DefaultWriteTimeout {
+		serverArgs = append(serverArgs, "--write-timeout", writeTimeoutFlag.String())
+	}
+	if bufferSizeFlag != "" {
+		serverArgs = append(serverArgs, "--buffer-size", bufferSizeFlag)
+	}
+	if persistBufFlag {
+		serverArgs = append(serverArgs, "--persist-buffer")
+	}
+	if dir != "" {
+		serverArgs = append(serverArgs, "--cwd", dir)
+	}
+	for _, kv := range envFlags {
+		serverArgs = append(serverArgs, "--env", kv)
+	}
+	if termFlag != "" {
+		serverArgs = append(serverArgs, "--term", termFlag)
+	}
+	if viaShellFlag {
+		serverArgs = append(serverArgs, "--shell")
+	}
+	if restartFlag != "" {
+		serverArgs = append(serverArgs, "--restart="+restartFlag)
+	}
+	if listenAddr != "" {
+		serverArgs = append(serverArgs, "--listen", "tcp:"+listenAddr)
+	}
+	if noAuthFlag {
+		serverArgs = append(serverArgs, "--no-auth")
+	}
+	for _, tag := range tagFlags {
+		serverArgs = append(serverArgs, "--tag", tag)
+	}
+	if groupFlag != "" {
+		serverArgs = append(serverArgs, "--group", groupFlag)
+	}
+	// The command may start with "--" itself
+	serverArgs = append(serverArgs, name, "--")
+	serverArgs = append(serverArgs, command...)
 	serverCmd := exec.Command(exe, serverArgs...)
 	serverCmd.Env = append(os.Environ(), "TUCK_SERVER=1")
 	serverCmd.SysProcAttr = &syscall.SysProcAttr{
@@ -84,34 +234,35 @@ func createAndAttachSession(name string, command []string) {
 		os.Exit(1)
 	}
 
-	// Wait a bit for server to start and then attach
-	for i := range 50 {
-		if session.Exists(name) {
+	// Wait for our server to start, or to fail. Its error file is only read
+	// once it has exited: a server started for the same name at the same
+	// time fails with "already exists" and writes to the same file.
+	exited := make(chan struct{})
+	go func() {
+		_ = serverCmd.Wait()
+		close(exited)
+	}()
+	started := false
+	for range 50 {
+		if serving(name, serverCmd.Process.Pid) {
+			started = true
 			break
 		}
-		// Check if server wrote an error
-		if errPath != "" {
-			if errData, err := os.ReadFile(errPath); err == nil && len(errData) > 0 {
-				_ = os.Remove(errPath)
-				fmt.Fprintf(os.Stderr, "Error: %s\n", string(errData))
-				os.Exit(1)
+		select {
+		case <-exited:
+			if errPath != "" {
+				if errData, err := os.ReadFile(errPath); err == nil && len(errData) > 0 {
+					_ = os.Remove(errPath)
+					fmt.Fprintf(os.Stderr, "Error: %s\n", string(errData))
+					os.Exit(1)
+				}
 			}
+			fmt.Fprintf(os.Stderr, "Error: failed to create session (server exited)\n")
+			os.Exit(1)
+		case <-time.After(100 * time.Millisecond):
 		}
-		if i == 49 {
-			break
-		}
-		sleepMs(100)
 	}
-
-	if !session.Exists(name) {
-		// Check for error file one more time
-		if errPath != "" {
-			if errData, err := os.ReadFile(errPath); err == nil && len(errData) > 0 {
-				_ = os.Remove(errPath)
-				fmt.Fprintf(os.Stderr, "Error: %s\n", string(errData))
-				os.Exit(1)
-			}
-		}
+	if !started {
 		fmt.Fprintf(os.Stderr, "Error: failed to create session (server did not start)\n")
 		os.Exit(1)
 	}
@@ -122,20 +273,94 @@ func createAndAttachSession(name string, command []string) {
 		fmt.Fprintf(os.Stderr, "[%s: ✨ created %q (%s to detach)]\n",
 			session.AppName, name, session.FormatDetachKeys(detachKeys))
 	}
+	if listenAddr != "" {
+		// Always shown: remote clients need the token, and without one
+		// anyone who can reach the port can control the session
+		token := ""
+		if sess, err := session.Load(name); err == nil {
+			listenAddr = sess.ListenAddr
+			token = sess.Token
+		}
+		if token != "" {
+			fmt.Fprintf(os.Stderr, "[%s: 🔑 listening on tcp://%s@%s]\n", session.AppName, token, listenAddr)
+		} else {
+			fmt.Fprintf(os.Stderr, "[%s: ⚠️ listening on tcp://%s without authentication]\n", session.AppName, listenAddr)
+		}
+	}
 
 	// Attach to the session
 	if err := session.Attach(name, session.AttachOptions{
 		Quiet:            quietFlag,
 		SuppressAttached: true,
 		DetachKeys:       detachKeys,
+		SuspendKey:       mustGetSuspendKey(),
+		EscapeActions:    mustGetEscapeActions(),
+		Compress:         compressFlag,
+		NoTitle:          noTitleFlag,
 	}); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, session.ErrNotTerminal) {
+			fmt.Fprintf(os.Stderr, "Session %q keeps running; use \"tuck logs -f %s\" to follow its output\n", name, name)
+		}
 		os.Exit(1)
 	}
 }
 
 func runServer(name string, command []string) {
-	server, err := session.NewServer(name, command)
+	var server *session.Server
+	logPath, err := resolveLogPath(name)
+	recordPath := ""
+	if err == nil && recordFlag {
+		recordPath, err = session.RecordPath(name)
+	}
+	bufferSize := 0
+	if err == nil {
+		bufferSize, err = parseSize(bufferSizeFlag)
+	}
+	bufferPath := ""
+	if err == nil && persistBufFlag {
+		bufferPath, err = session.BufferPath(name)
+	}
+	listenAddr := ""
+	if err == nil {
+		listenAddr, err = parseListenAddr(listenFlag)
+	}
+	var rows, cols uint16
+	if err == nil {
+		rows, cols, err = parseWinSize(winSizeFlag)
+	}
+	// Inherited from the process that started the server
+	debugPath := ""
+	if err == nil && os.Getenv("TUCK_DEBUG") == "1" {
+		debugPath, err = session.DebugLogPath(name)
+	}
+	if err == nil {
+		server, err = session.NewServer(name, command, session.ServerOptions{
+			LogPath:     logPath,
+			RecordPath:  recordPath,
+			IdleTimeout: idleTimeoutFlag,
+			BufferSize:  bufferSize,
+			BufferPath:  bufferPath,
+			Dir:         cwdFlag,
+			Env:         envFlags,
+			Shell:       cfg.Shell,
+			Term:        termFlag,
+			ViaShell:    viaShellFlag,
+			Restart:     restartFlag,
+			ListenAddr:  listenAddr,
+			NoAuth:      noAuthFlag,
+			Tags:        tagFlags,
+			Group:       groupFlag,
+			Rows:        rows,
+			Cols:        cols,
+			PinnedRows:  heightFlag,
+			PinnedCols:  widthFlag,
+
+			WriteTimeout: writeTimeoutFlag,
+			LogNormalize: logNormalizeFlag,
+			DebugLogPath: debugPath,
+		})
+	}
 	if err != nil {
 		// Write error to file for client to read
 		if errPath, pathErr := session.ErrorPath(name); pathErr == nil {
@@ -146,32 +371,181 @@ func runServer(name string, command []string) {
 	_ = server.Run()
 }
 
-func sleepMs(ms int) {
-	time.Sleep(time.Duration(ms) * time.Millisecond)
+// serving reports whether the session is up and served by the given process
+func serving(name string, pid int) bool {
+	if !session.Exists(name) {
+		return false
+	}
+	s, err := session.Load(name)
+	return err == nil && s.PID == pid
 }
 
-// generateSessionName creates a session name from current directory
-func generateSessionName() string {
-	cwd, err := os.Getwd()
+// commandArgs returns the command given after a session name, dropping the
+// "--" that may separate them. Flag parsing stops at the name, so the rest
+// is the command, flags and all.
+func commandArgs(args []string) []string {
+	if len(args) > 0 && args[0] == "--" {
+		return args[1:]
+	}
+	return args
+}
+
+// resolveLogPath returns the output log path from flags, or "" if logging is off
+func resolveLogPath(name string) (string, error) {
+	if logFileFlag != "" {
+		return filepath.Abs(logFileFlag)
+	}
+	if logFlag || logNormalizeFlag {
+		return session.LogPath(name)
+	}
+	return "", nil
+}
+
+// resolveDir validates --cwd and returns it as an absolute path ("" if unset)
+func resolveDir() (string, error) {
+	if cwdFlag == "" {
+		return "", nil
+	}
+	dir, err := filepath.Abs(cwdFlag)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(dir)
 	if err != nil {
-		return "session"
+		return "", fmt.Errorf("invalid working directory: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("invalid working directory: %s is not a directory", dir)
+	}
+	return dir, nil
+}
+
+// parseListenAddr parses --listen ("tcp:HOST:PORT" or "tcp://HOST:PORT") into host:port
+func parseListenAddr(s string) (string, error) {
+	if s == "" {
+		return "", nil
 	}
-	base := filepath.Base(cwd)
-	if base == "" || base == "/" || base == "." {
-		base = "session"
+	addr, ok := strings.CutPrefix(s, "tcp://")
+	if !ok {
+		addr, ok = strings.CutPrefix(s, "tcp:")
 	}
+	if !ok {
+		return "", fmt.Errorf("invalid listen address: %q (use tcp:HOST:PORT)", s)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", fmt.Errorf("invalid listen address: %q (use tcp:HOST:PORT)", s)
+	}
+	return addr, nil
+}
+
+// parseWinSize parses --size (COLSxROWS, e.g. 120x40); "" gives 0, 0
+func parseWinSize(s string) (rows, cols uint16, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	c, r, ok := strings.Cut(s, "x")
+	if ok {
+		var cols64, rows64 uint64
+		cols64, err = strconv.ParseUint(c, 10, 16)
+		if err == nil {
+			rows64, err = strconv.ParseUint(r, 10, 16)
+		}
+		if err == nil && cols64 > 0 && rows64 > 0 {
+			return uint16(rows64), uint16(cols64), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid size: %q (use COLSxROWS, e.g. 120x40)", s)
+}
+
+// validateEnv checks that each --env entry is KEY=VALUE with a valid name
+func validateEnv(env []string) error {
+	for _, kv := range env {
+		key, _, ok := strings.Cut(kv, "=")
+		if !ok || !isEnvName(key) {
+			return fmt.Errorf("invalid environment variable: %q (use KEY=VALUE)", kv)
+		}
+	}
+	return nil
+}
+
+// validateTags checks that each --tag is a non-empty word
+func validateTags(tags []string) error {
+	for _, tag := range tags {
+		if !isWord(tag) {
+			return fmt.Errorf("invalid tag: %q (tags can't be empty or contain commas or spaces)", tag)
+		}
+	}
+	return nil
+}
 
-	// If base name is available, use it
-	if !session.Exists(base) {
-		return base
+// validateRestart checks a --restart policy
+func validateRestart(policy string) error {
+	switch policy {
+	case "", session.RestartAlways, session.RestartOnFailure:
+		return nil
 	}
+	return fmt.Errorf("invalid restart policy: %q (use %s or %s)", policy, session.RestartAlways, session.RestartOnFailure)
+}
+
+// isWord reports whether s is non-empty and has no commas or whitespace
+func isWord(s string) bool {
+	return s != "" && !strings.ContainsAny(s, ", \t\n")
+}
 
-	// Otherwise, append a number
-	for i := 1; i < 1000; i++ {
-		name := fmt.Sprintf("%s-%d", base, i)
-		if !session.Exists(name) {
-			return name
+// isEnvName reports whether s is a valid environment variable name
+func isEnvName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
 		}
 	}
-	return base
+	return true
+}
+
+// parseSize parses a byte size like "512K", "4M" or "1G" ("" = 0)
+func parseSize(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	num := strings.TrimRight(strings.ToUpper(s), "B")
+	mult := 1
+	switch {
+	case strings.HasSuffix(num, "K"):
+		mult = 1024
+	case strings.HasSuffix(num, "M"):
+		mult = 1024 * 1024
+	case strings.HasSuffix(num, "G"):
+		mult = 1024 * 1024 * 1024
+	}
+	if mult > 1 {
+		num = num[:len(num)-1]
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size: %q (use e.g. 512K, 4M)", s)
+	}
+	return n * mult, nil
+}
+
+// nameScheme returns the scheme for generated session names from the
+// --scheme flag, $TUCK_NAME_SCHEME or config, or exits if it's unknown
+func nameScheme() string {
+	scheme := schemeFlag
+	if scheme == "" {
+		scheme = os.Getenv("TUCK_NAME_SCHEME")
+	}
+	if scheme == "" {
+		scheme = cfg.NameScheme
+	}
+	if err := session.ValidateNameScheme(scheme); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return scheme
 }
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCommandArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "none", args: nil, want: nil},
+		{name: "command", args: []string{"make", "test"}, want: []string{"make", "test"}},
+		{name: "separator dropped", args: []string{"--", "make", "test"}, want: []string{"make", "test"}},
+		{name: "separator alone", args: []string{"--"}, want: []string{}},
+		{name: "later separator kept", args: []string{"git", "log", "--", "README.md"}, want: []string{"git", "log", "--", "README.md"}},
+		{name: "command starting with separator", args: []string{"--", "--", "x"}, want: []string{"--", "x"}},
+		{name: "dash arguments", args: []string{"ls", "-la", "--color=auto"}, want: []string{"ls", "-la", "--color=auto"}},
+		{name: "dash command", args: []string{"--", "-weird"}, want: []string{"-weird"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commandArgs(tt.args); !slices.Equal(got, tt.want) {
+				t.Errorf("commandArgs(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+// parseArgs parses argv with cmd's flags, as cobra does before Run, and
+// returns the positional arguments. Flags set in argv are reset afterwards.
+func parseArgs(t *testing.T, cmd *cobra.Command, argv []string) []string {
+	t.Helper()
+	flags := cmd.Flags()
+	t.Cleanup(func() {
+		for _, name := range []string{"group", "no-replay"} {
+			if f := flags.Lookup(name); f != nil && f.Changed {
+				_ = f.Value.Set(f.DefValue)
+				f.Changed = false
+			}
+		}
+	})
+	if err := flags.Parse(argv); err != nil {
+		t.Fatalf("parsing %q: %v", argv, err)
+	}
+	return flags.Args()
+}
+
+func TestCommandAfterName(t *testing.T) {
+	tests := []struct {
+		name        string
+		argv        []string
+		wantName    string
+		wantCommand []string
+		wantGroup   string
+	}{
+		{
+			name:        "dash arguments",
+			argv:        []string{"job", "kubectl", "logs", "-f", "pod"},
+			wantName:    "job",
+			wantCommand: []string{"kubectl", "logs", "-f", "pod"},
+		},
+		{
+			name:        "separator",
+			argv:        []string{"job", "--", "kubectl", "logs", "-f", "pod"},
+			wantName:    "job",
+			wantCommand: []string{"kubectl", "logs", "-f", "pod"},
+		},
+		{
+			name:        "flags before the name",
+			argv:        []string{"--group", "ci", "job", "--", "make", "--group", "x"},
+			wantName:    "job",
+			wantCommand: []string{"make", "--group", "x"},
+			wantGroup:   "ci",
+		},
+		{
+			name:        "flag names in the command",
+			argv:        []string{"job", "sh", "--force", "-e", "x"},
+			wantName:    "job",
+			wantCommand: []string{"sh", "--force", "-e", "x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := parseArgs(t, createCmd, tt.argv)
+			if len(args) == 0 || args[0] != tt.wantName {
+				t.Fatalf("args = %q, want the name %q first", args, tt.wantName)
+			}
+			if got := commandArgs(args[1:]); !slices.Equal(got, tt.wantCommand) {
+				t.Errorf("command = %q, want %q", got, tt.wantCommand)
+			}
+			if groupFlag != tt.wantGroup {
+				t.Errorf("--group = %q, want %q", groupFlag, tt.wantGroup)
+			}
+		})
+	}
+}
+
+func TestAttachFlagAfterName(t *testing.T) {
+	args := parseArgs(t, attachCmd, []string{"work", "--no-replay"})
+	if !slices.Equal(args, []string{"work", "--no-replay"}) {
+		t.Fatalf("args = %q, want the flag left after the name", args)
+	}
+	err := attachCmd.Args(attachCmd, args)
+	if err == nil || !strings.Contains(err.Error(), "before the session name") {
+		t.Errorf("Args() error = %v, want one about flags going before the name", err)
+	}
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rot1024/tuck/session"
+	"github.com/spf13/cobra"
+)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove files left behind by dead sessions",
+	Long: `Remove files left behind by sessions whose server is gone, such as the
+socket of a server that crashed. Running sessions are kept, and so are
+exited ones for a day after their command exited.
+With --log, output logs and recordings of sessions that no longer exist
+are removed too.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		removed, err := session.Prune(removeLogFlag)
+		if !quietFlag {
+			for _, path := range removed {
+				fmt.Printf("Removed %s\n", path)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(removed) == 0 && !quietFlag {
+			fmt.Println("Nothing to prune")
+		}
+	},
+}
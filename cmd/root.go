@@ -3,12 +3,13 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/rot1024/tuck/session"
 	"github.com/spf13/cobra"
 )
 
-// getDetachKeys returns the detach keys from flags or environment variables
+// getDetachKeys returns the detach keys from flags, environment variables or config
 func getDetachKeys() ([]session.DetachKey, error) {
 	var keyStrs []string
 
@@ -27,7 +28,10 @@ func getDetachKeys() ([]session.DetachKey, error) {
 		keyStrs = append(keyStrs, envKey)
 	}
 
-	// Use defaults if none specified
+	// Fall back to config, then defaults
+	if len(keyStrs) == 0 {
+		keyStrs = cfg.DetachKeys
+	}
 	if len(keyStrs) == 0 {
 		return session.DefaultDetachKeys, nil
 	}
@@ -54,6 +58,42 @@ func mustGetDetachKeys() []session.DetachKey {
 	return keys
 }
 
+// mustGetSuspendKey returns the control key that suspends the client
+// (0 if none is configured) or exits on error
+func mustGetSuspendKey() byte {
+	s := suspendKeyFlag
+	if s == "" {
+		s = cfg.SuspendKey
+	}
+	if s == "" {
+		return 0
+	}
+	key, err := session.ParseDetachKey(s)
+	if err == nil && (key.IsEscapeSequence() || key.IsChord()) {
+		err = fmt.Errorf("invalid suspend key: %q (use a control key like ctrl-z)", s)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return key.CtrlKey
+}
+
+// mustGetEscapeActions returns what keys typed after the escape char do,
+// from flags or config, or exits on error
+func mustGetEscapeActions() map[byte]session.EscapeAction {
+	specs := escapeActionFlags
+	if len(specs) == 0 {
+		specs = cfg.EscapeActions
+	}
+	actions, err := session.ParseEscapeActions(specs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return actions
+}
+
 // checkNotNested exits if already inside a tuck session
 func checkNotNested() {
 	if s := os.Getenv("TUCK_SESSION"); s != "" {
@@ -63,8 +103,38 @@ func checkNotNested() {
 }
 
 var (
-	quietFlag      bool
-	detachKeyFlags []string
+	quietFlag       bool
+	compressFlag    bool
+	noTitleFlag     bool
+	detachKeyFlags  []string
+	suspendKeyFlag  string
+	logFlag         bool
+	logFileFlag     string
+	removeLogFlag   bool
+	recordFlag      bool
+	idleTimeoutFlag time.Duration
+	bufferSizeFlag  string
+	persistBufFlag  bool
+	cwdFlag         string
+	envFlags        []string
+	listenFlag      string
+	noAuthFlag      bool
+	tagFlags        []string
+	groupFlag       string
+	termFlag        string
+	restartFlag     string
+	viaShellFlag    bool
+	forceFlag       bool
+	nameFlag        string
+	schemeFlag      string
+	widthFlag       uint16
+	heightFlag      uint16
+
+	writeTimeoutFlag time.Duration
+	winSizeFlag      string
+	logNormalizeFlag bool
+
+	escapeActionFlags []string
 )
 
 var rootCmd = &cobra.Command{
@@ -74,7 +144,12 @@ var rootCmd = &cobra.Command{
 detach and reattach terminal sessions without screen splitting.
 
 Unlike tmux or screen, tuck does not use the alternate screen buffer,
-so your terminal's scrollback buffer remains functional.`,
+so your terminal's scrollback buffer remains functional.
+
+Defaults can be set in ~/.config/tuck/config.toml (or $TUCK_CONFIG).`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		applyConfig(cmd)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		// Default to "tuck new" behavior
 		newCmd.Run(cmd, args)
@@ -89,17 +164,72 @@ func Execute() {
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&quietFlag, "quiet", "q", false, "Suppress status messages")
-	rootCmd.PersistentFlags().StringArrayVarP(&detachKeyFlags, "detach-key", "d", nil, "Detach key (e.g., `., ~., ctrl-a). Can be specified multiple times")
+	rootCmd.PersistentFlags().BoolVar(&compressFlag, "compress", false, "Compress session output over the socket (for slow forwarded sockets)")
+	rootCmd.PersistentFlags().BoolVar(&noTitleFlag, "no-title", false, "Don't set the terminal title to the session name")
+	rootCmd.PersistentFlags().StringArrayVarP(&detachKeyFlags, "detach-key", "d", nil, "Detach key (e.g., `., ~., ctrl-a, \"C-b d\"). Can be specified multiple times")
+	rootCmd.PersistentFlags().StringVar(&suspendKeyFlag, "suspend-key", "", "Control key that suspends the client (e.g., ctrl-z); ~ then Ctrl+Z always works")
+	rootCmd.PersistentFlags().StringArrayVar(&escapeActionFlags, "escape-action", nil, "Bind a key typed after the escape char, as KEY=ACTION (detach, suspend, kill, help, none; e.g., x=kill). Can be specified multiple times")
+
+	// Session creation flags (root behaves like "tuck new")
+	for _, c := range []*cobra.Command{rootCmd, newCmd, createCmd} {
+		c.Flags().BoolVarP(&forceFlag, "force", "f", false, "Replace a session of the same name whose server is no longer running")
+		c.Flags().StringVar(&cwdFlag, "cwd", "", "Working directory for the session command")
+		c.Flags().StringArrayVarP(&envFlags, "env", "e", nil, "Set an environment variable (KEY=VALUE). Can be specified multiple times")
+		c.Flags().StringVar(&termFlag, "term", "", "TERM for the session command (default: inherited, or "+session.DefaultTerm+")")
+		c.Flags().BoolVarP(&viaShellFlag, "shell", "s", false, "Run the command through $SHELL -lc, so aliases and profile setup apply")
+		c.Flags().StringVar(&restartFlag, "restart", "", "Run the command again when it exits (always, on-failure)")
+		c.Flags().Lookup("restart").NoOptDefVal = session.RestartAlways
+		c.Flags().StringVar(&listenFlag, "listen", "", "Also accept clients over TCP (tcp:HOST:PORT)")
+		c.Flags().StringVar(&groupFlag, "group", "", "Add the session to a group, to list or clear it with the others")
+		c.Flags().StringArrayVar(&tagFlags, "tag", nil, "Label the session (e.g., --tag ci). Can be specified multiple times")
+		c.Flags().BoolVar(&noAuthFlag, "no-auth", false, "Accept clients without the session token")
+		c.Flags().BoolVar(&logFlag, "log", false, "Log session output to <data dir>/<name>.log")
+		c.Flags().StringVar(&logFileFlag, "log-file", "", "Log session output to the given file")
+		c.Flags().BoolVar(&logNormalizeFlag, "log-normalize", false, "Log lines as they end up on screen, so progress bars redrawn with \\r leave one line (implies --log)")
+		c.Flags().BoolVar(&recordFlag, "record", false, "Record timestamped session output for \"tuck export\"")
+		c.Flags().StringVar(&bufferSizeFlag, "buffer-size", "", "Output replayed on attach (e.g., 512K, 4M; default 1M)")
+		c.Flags().BoolVar(&persistBufFlag, "persist-buffer", false, "Save the output replayed on attach to disk, and restore it when a session of the same name is created")
+		c.Flags().DurationVar(&idleTimeoutFlag, "idle-timeout", 0, "End the session after this long without clients or output (e.g., 30m; 0 = never)")
+		c.Flags().Uint16Var(&widthFlag, "width", 0, "Keep the terminal this many columns wide, whatever size clients have")
+		c.Flags().Uint16Var(&heightFlag, "height", 0, "Keep the terminal this many rows high, whatever size clients have")
+		c.Flags().StringVar(&winSizeFlag, "size", "", "Terminal size the command starts with, as COLSxROWS (default: this terminal's)")
+		c.Flags().DurationVar(&writeTimeoutFlag, "write-timeout", session.DefaultWriteTimeout, "Disconnect a client when sending it output takes longer than this")
+	}
+
+	for _, c := range []*cobra.Command{rootCmd, newCmd} {
+		c.Flags().StringVar(&nameFlag, "name", "", "Session name (default: based on the current directory)")
+		c.Flags().StringVar(&schemeFlag, "scheme", "", "How to generate the session name (dir, timestamp, random)")
+	}
+
+	deleteCmd.Flags().BoolVar(&removeLogFlag, "log", false, "Also remove the session output log and recording")
+	clearCmd.Flags().BoolVar(&removeLogFlag, "log", false, "Also remove the session output logs and recordings")
+	clearCmd.Flags().StringVar(&clearGroup, "group", "", "Only delete sessions in this group")
+	killCmd.Flags().BoolVar(&removeLogFlag, "log", false, "Also remove the session output log and recording")
+	pruneCmd.Flags().BoolVar(&removeLogFlag, "log", false, "Also remove output logs and recordings of sessions that no longer exist")
 
 	// Allow command arguments with dashes (e.g., "claude --continue")
 	newCmd.Flags().SetInterspersed(false)
 	createCmd.Flags().SetInterspersed(false)
+	sendCmd.Flags().SetInterspersed(false)
+	attachCmd.Flags().SetInterspersed(false)
 	rootCmd.Flags().SetInterspersed(false)
 
 	rootCmd.AddCommand(newCmd)
 	rootCmd.AddCommand(createCmd)
 	rootCmd.AddCommand(attachCmd)
 	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(infoCmd)
 	rootCmd.AddCommand(deleteCmd)
+	rootCmd.AddCommand(killCmd)
+	rootCmd.AddCommand(renameCmd)
+	rootCmd.AddCommand(moveCmd)
 	rootCmd.AddCommand(clearCmd)
+	rootCmd.AddCommand(pruneCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(captureCmd)
+	rootCmd.AddCommand(logsCmd)
+	rootCmd.AddCommand(sendCmd)
+	rootCmd.AddCommand(waitCmd)
+	rootCmd.AddCommand(eventsCmd)
 }
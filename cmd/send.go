@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rot1024/tuck/session"
+	"github.com/spf13/cobra"
+)
+
+var sendCmd = &cobra.Command{
+	Use:   "send-keys <name> <keys...>",
+	Short: "Send input to a session without attaching",
+	Long: `Send keys to a running session as if they were typed.
+
+Each argument is a key name (Enter, Tab, Escape, Space, BSpace, Up, Down,
+Left, Right, Home, End), a control key (C-c, ctrl-c, ^c), or literal text.
+Literal text supports \n, \r, \t, \e and \\ escapes.
+
+Example:
+  tuck send-keys build 'make test\n'
+  tuck send-keys build C-c`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		data, err := session.ParseKeys(commandArgs(args[1:]))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(data) == 0 {
+			return
+		}
+
+		if err := session.SendInput(name, data); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
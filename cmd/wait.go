@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/rot1024/tuck/session"
+	"github.com/spf13/cobra"
+)
+
+var (
+	waitBell bool
+	waitExec string
+)
+
+var waitCmd = &cobra.Command{
+	Use:   "wait <name>",
+	Short: "Wait until a session's command exits",
+	Long: `Wait until a session's command exits, without attaching.
+Returns immediately if the session has already exited.
+
+Use --bell to ring the terminal bell, or --exec to run a command
+(e.g., a desktop notification) when the session ends. The command is run
+with sh -c and receives the session name as $1. A default command can be
+set with notify_command in the config file.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeSessionName,
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		if err := session.Wait(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if !quietFlag {
+			fmt.Fprintf(os.Stderr, "[%s: 🏁 ended %q]\n", session.AppName, name)
+		}
+		if waitBell {
+			fmt.Fprint(os.Stderr, "\a")
+		}
+
+		hook := waitExec
+		if hook == "" {
+			hook = cfg.NotifyCommand
+		}
+		if hook != "" {
+			hookCmd := exec.Command("sh", "-c", hook, "sh", name)
+			hookCmd.Stdout = os.Stdout
+			hookCmd.Stderr = os.Stderr
+			if err := hookCmd.Run(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: notify command failed: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	waitCmd.Flags().BoolVar(&waitBell, "bell", false, "Ring the terminal bell when the session ends")
+	waitCmd.Flags().StringVar(&waitExec, "exec", "", "Run a shell command when the session ends ($1 = session name)")
+}
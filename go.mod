@@ -3,6 +3,7 @@ module github.com/rot1024/tuck
 go 1.24.0
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/creack/pty v1.1.24
 	github.com/spf13/cobra v1.10.2
 	golang.org/x/term v0.39.0
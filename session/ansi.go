@@ -0,0 +1,181 @@
+package session
+
+import (
+	"bytes"
+	"net/url"
+	"unicode/utf8"
+)
+
+// altScreenSeqs switch to and from the alternate screen used by full-screen
+// programs (xterm modes 1049, 1047 and 47)
+var altScreenSeqs = []struct {
+	seq []byte
+	on  bool
+}{
+	{[]byte("\x1b[?1049h"), true},
+	{[]byte("\x1b[?1049l"), false},
+	{[]byte("\x1b[?1047h"), true},
+	{[]byte("\x1b[?1047l"), false},
+	{[]byte("\x1b[?47h"), true},
+	{[]byte("\x1b[?47l"), false},
+}
+
+// maxAltScreenSeq is the length of the longest alternate screen switch
+const maxAltScreenSeq = 8
+
+// clearSeqs clear the whole screen (ED 2, ED 3) or reset the terminal (RIS)
+var clearSeqs = [][]byte{
+	[]byte("\x1b[2J"),
+	[]byte("\x1b[3J"),
+	[]byte("\x1bc"),
+}
+
+// osc7Prefix starts the sequence shells report their working directory
+// with: ESC ] 7 ; file://HOST/PATH, ended by BEL or ST
+var osc7Prefix = []byte("\x1b]7;")
+
+// reportedDir returns the directory in the last OSC 7 sequence in data,
+// or "" if there is none (or it is cut off)
+func reportedDir(data []byte) string {
+	i := bytes.LastIndex(data, osc7Prefix)
+	if i < 0 {
+		return ""
+	}
+	rest := data[i+len(osc7Prefix):]
+	end := bytes.IndexAny(rest, "\x07\x1b")
+	if end < 0 {
+		return ""
+	}
+	u, err := url.Parse(string(rest[:end]))
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return u.Path
+}
+
+// osc7 returns the sequence that tells the terminal the working directory
+func osc7(host, dir string) []byte {
+	u := url.URL{Scheme: "file", Host: host, Path: dir}
+	return []byte("\x1b]7;" + u.String() + "\x1b\\")
+}
+
+// lastScreen returns roughly the part of buf that makes up the current
+// screen: the output since the last clear, or the last rows×cols bytes if
+// that is shorter. A cut that isn't at a clear is moved past the next
+// newline, so it doesn't start in the middle of a line or escape sequence.
+func lastScreen(buf []byte, rows, cols int) []byte {
+	start := max(0, len(buf)-rows*cols)
+	cleared := -1
+	for _, seq := range clearSeqs {
+		cleared = max(cleared, bytes.LastIndex(buf, seq))
+	}
+	if cleared >= start {
+		return buf[cleared:]
+	}
+	if start > 0 {
+		if i := bytes.IndexByte(buf[start:], '\n'); i >= 0 {
+			start += i + 1
+		}
+	}
+	return buf[start:]
+}
+
+// altScreen reports whether the terminal is on the alternate screen after
+// data, given whether it was before. Only the last switch counts, so
+// nested or repeated switches don't matter.
+func altScreen(data []byte, on bool) bool {
+	last := -1
+	for _, s := range altScreenSeqs {
+		if i := bytes.LastIndex(data, s.seq); i > last {
+			last, on = i, s.on
+		}
+	}
+	return on
+}
+
+// StripANSI removes terminal escape sequences (CSI, OSC and friends) and
+// control characters other than newlines and tabs, leaving plain text.
+// Bytes of multibyte UTF-8 characters are passed through untouched.
+func StripANSI(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		if b != 0x1b {
+			if b == '\n' || b == '\t' || (b >= 0x20 && b != 0x7f) {
+				out = append(out, b)
+			}
+			continue
+		}
+		i = escEnd(data, i) - 1
+	}
+	return out
+}
+
+// escEnd returns the index just past the escape sequence starting at
+// data[i] (an ESC), or len(data) if the sequence is cut off
+func escEnd(data []byte, i int) int {
+	if i+1 >= len(data) {
+		return len(data)
+	}
+	switch data[i+1] {
+	case '[':
+		// CSI: parameters and intermediates, then a final byte in @-~
+		i += 2
+		for i < len(data) && (data[i] < 0x40 || data[i] > 0x7e) {
+			i++
+		}
+	case ']', 'P', '_', '^', 'X':
+		// OSC, DCS, APC, PM, SOS: a string terminated by BEL or ST (ESC \)
+		i += 2
+		for i < len(data) && data[i] != 0x07 {
+			if data[i] == 0x1b && i+1 < len(data) && data[i+1] == '\\' {
+				i++
+				break
+			}
+			i++
+		}
+	default:
+		// ESC, any intermediates (e.g. "(" in ESC ( B), then a final byte
+		i++
+		for i < len(data) && data[i] >= 0x20 && data[i] <= 0x2f {
+			i++
+		}
+		if i < len(data) && (data[i] < 0x30 || data[i] > 0x7e) {
+			// Not a valid sequence; it ends before the byte after ESC
+			return i
+		}
+	}
+	return min(i+1, len(data))
+}
+
+// maxEscLookback bounds how far back safeTrimStart looks for the start of
+// an escape sequence. Longer ones (e.g. large OSC payloads) are rare.
+const maxEscLookback = 4096
+
+// safeTrimStart drops bytes from the start of buf so at most n remain,
+// moving the cut forward so that it falls neither inside an escape sequence
+// nor inside a UTF-8 character. A replay starting there is clean.
+func safeTrimStart(buf []byte, n int) []byte {
+	if len(buf) <= n {
+		return buf
+	}
+	start := len(buf) - n
+
+	// Skip the rest of a sequence that began before the cut, if it ends
+	// within maxEscLookback of it: one that never ends (e.g. an OSC without
+	// its BEL or ST) would otherwise take the rest of the buffer with it.
+	// The byte added tells a sequence ending right at the limit from one
+	// cut off there.
+	from := max(0, start-maxEscLookback)
+	if i := bytes.LastIndexByte(buf[from:start], 0x1b); i >= 0 {
+		seq := append(bytes.Clone(buf[from+i:min(len(buf), start+maxEscLookback)]), 'x')
+		if end := escEnd(seq, 0); end < len(seq) {
+			start = max(start, from+i+end)
+		}
+	}
+	// Skip continuation bytes of a character that began before the cut
+	for k := 0; k < utf8.UTFMax-1 && start < len(buf) && !utf8.RuneStart(buf[start]); k++ {
+		start++
+	}
+	return buf[start:]
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEscEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want int
+	}{
+		{name: "CSI", data: "\x1b[31mred", want: 5},
+		{name: "CSI with private parameters", data: "\x1b[?1049hx", want: 8},
+		{name: "CSI cut off", data: "\x1b[31", want: 4},
+		{name: "OSC ended by BEL", data: "\x1b]0;title\x07x", want: 10},
+		{name: "OSC ended by ST", data: "\x1b]7;file://h/tmp\x1b\\x", want: 18},
+		{name: "OSC cut off", data: "\x1b]0;tit", want: 7},
+		{name: "DCS", data: "\x1bPq#0\x1b\\x", want: 7},
+		{name: "charset", data: "\x1b(Bx", want: 3},
+		{name: "two bytes", data: "\x1bcx", want: 2},
+		{name: "lone ESC", data: "\x1b", want: 1},
+		{name: "invalid", data: "\x1b\x01x", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := escEnd([]byte(tt.data), 0); got != tt.want {
+				t.Errorf("escEnd(%q) = %d, want %d", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSafeTrimStart(t *testing.T) {
+	long := strings.Repeat("a", maxEscLookback*2)
+	tests := []struct {
+		name string
+		buf  string
+		n    int
+		want string
+	}{
+		{name: "short enough", buf: "hello", n: 10, want: "hello"},
+		{name: "plain", buf: "hello world", n: 5, want: "world"},
+		{name: "inside a 2-byte character", buf: "abé!", n: 2, want: "!"},
+		{name: "inside a 3-byte character", buf: "a日本", n: 4, want: "本"},
+		{name: "inside a 4-byte character", buf: "a😀b", n: 3, want: "b"},
+		{name: "at a character", buf: "a日本", n: 6, want: "日本"},
+		{name: "inside a CSI", buf: "ab\x1b[38;5;196mred", n: 8, want: "red"},
+		{name: "at an ESC", buf: "ab\x1b[1mx", n: 5, want: "\x1b[1mx"},
+		{name: "inside an OSC ended by BEL", buf: "a\x1b]0;title\x07text", n: 8, want: "text"},
+		{name: "inside an OSC ended by ST", buf: "a\x1b]0;title\x1b\\text", n: 8, want: "text"},
+		{name: "after a sequence", buf: "\x1b[1mbold", n: 3, want: "old"},
+		{name: "escape then character", buf: "\x1b[1mé", n: 1, want: ""},
+		{name: "sequence ending at the end", buf: "ab\x1b[1m", n: 2, want: ""},
+		{name: "unterminated OSC", buf: "\x1b]0;" + long, n: 100, want: long[len(long)-100:]},
+		{name: "long OSC", buf: "\x1b]0;" + long[:3000] + "\x07end", n: 2003, want: "end"},
+		{name: "OSC ending too far after the cut", buf: "\x1b]0;" + long + "\x07end", n: len(long) - 100 + 4, want: long[100:] + "\x07end"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := safeTrimStart([]byte(tt.buf), tt.n)
+			if !bytes.Equal(got, []byte(tt.want)) {
+				t.Errorf("safeTrimStart(%q, %d) = %q, want %q", abbrev(tt.buf), tt.n, abbrev(string(got)), abbrev(tt.want))
+			}
+			if len(got) > tt.n {
+				t.Errorf("safeTrimStart kept %d bytes, more than %d", len(got), tt.n)
+			}
+		})
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "colors", data: "\x1b[31mred\x1b[0m\n", want: "red\n"},
+		{name: "title", data: "\x1b]0;title\x07text", want: "text"},
+		{name: "multibyte", data: "\x1b[1m日本語\x1b[0m é", want: "日本語 é"},
+		{name: "control characters", data: "a\rb\x07c\td", want: "abc\td"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(StripANSI([]byte(tt.data))); got != tt.want {
+				t.Errorf("StripANSI(%q) = %q, want %q", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+// abbrev shortens long test strings in failure messages
+func abbrev(s string) string {
+	if len(s) > 40 {
+		return s[:20] + "…" + s[len(s)-20:]
+	}
+	return s
+}
@@ -1,12 +1,23 @@
 package session
 
 import (
+	"compress/flate"
+	"context"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"golang.org/x/term"
 )
@@ -19,8 +30,9 @@ var DefaultDetachKeys = []DetachKey{{EscapeChar: '~'}}
 
 // DetachKey represents a method to detach from a session
 type DetachKey struct {
-	CtrlKey    byte // Single control key (e.g., 28 for Ctrl+\)
+	CtrlKey    byte // Single control key (e.g., 28 for Ctrl+\), or a chord's prefix
 	EscapeChar byte // Escape character for sequence (e.g., '~' for ~.)
+	Action     byte // Key that completes a chord after CtrlKey (e.g., 'd' for Ctrl+B d)
 }
 
 // IsEscapeSequence returns true if this is an escape sequence (char + .)
@@ -28,11 +40,19 @@ func (d DetachKey) IsEscapeSequence() bool {
 	return d.EscapeChar != 0
 }
 
+// IsChord returns true if this is a prefix chord (control key, then another key)
+func (d DetachKey) IsChord() bool {
+	return d.Action != 0
+}
+
 // String returns a human-readable representation
 func (d DetachKey) String() string {
 	if d.IsEscapeSequence() {
 		return fmt.Sprintf("%c.", d.EscapeChar)
 	}
+	if d.IsChord() {
+		return fmt.Sprintf("%s %c", formatCtrlKey(d.CtrlKey), d.Action)
+	}
 	return formatCtrlKey(d.CtrlKey)
 }
 
@@ -60,11 +80,21 @@ func formatCtrlKey(key byte) string {
 // Formats:
 //   - "ctrl-a", "^a" → control key
 //   - "~.", "`." → escape sequence (char followed by .)
+//   - "C-b d", "ctrl-b d" → prefix chord (control key, then a printable key)
 func ParseDetachKey(s string) (DetachKey, error) {
 	if s == "" {
 		return DetachKey{}, fmt.Errorf("empty detach key")
 	}
 
+	// Handle chord format: prefix and action separated by a space
+	if prefix, action, ok := strings.Cut(s, " "); ok {
+		key, isCtrl := parseCtrlArg(prefix)
+		if isCtrl && len(action) == 1 && action[0] > ' ' && action[0] < 127 {
+			return DetachKey{CtrlKey: key, Action: action[0]}, nil
+		}
+		return DetachKey{}, fmt.Errorf("invalid detach key: %q (chords are a control key and a printable key, like \"C-b d\")", s)
+	}
+
 	// Handle escape sequence format: X. (any char followed by .)
 	if len(s) == 2 && s[1] == '.' {
 		return DetachKey{EscapeChar: s[0]}, nil
@@ -86,7 +116,7 @@ func ParseDetachKey(s string) (DetachKey, error) {
 		}
 	}
 
-	return DetachKey{}, fmt.Errorf("invalid detach key: %q (use ctrl-a, ^a, ~., `., etc.)", s)
+	return DetachKey{}, fmt.Errorf("invalid detach key: %q (use ctrl-a, ^a, ~., `., \"C-b d\", etc.)", s)
 }
 
 // parseCtrlChar parses a character for ctrl combination
@@ -132,42 +162,140 @@ func FormatDetachKeys(keys []DetachKey) string {
 	return result
 }
 
+// Keepalive settings: the server answers every ping, so a connection that
+// stays silent for pingTimeout means the server is gone
+const (
+	pingInterval = 5 * time.Second
+	pingTimeout  = 15 * time.Second
+)
+
+// resizeDebounce is how long the window size has to stay the same before
+// it is sent to the server, so that resizing doesn't flood the command
+// with SIGWINCH
+const resizeDebounce = 50 * time.Millisecond
+
 // Client connects to a session
 type Client struct {
 	conn       net.Conn
 	oldState   *term.State
 	done       chan struct{}
+	closeOnce  sync.Once // Several goroutines may detach at once
 	name       string
+	token      string // Presented in the handshake
+	socket     string // Socket path given instead of the name, if any
+	reconnect  bool   // Connect again when the connection is lost
+	reportCwd  bool   // Tell the terminal the session's working directory on attach
 	quiet      bool
+	readOnly   bool
+	takeover   bool // Detach every other attached client on attach
+	clients    int  // Attached clients, including this one (0 = not known yet)
 	detachKeys []DetachKey
+	suspendKey byte // Control key that suspends the client (0 = none)
+	// What keys typed after the escape char do
+	escapeActions map[byte]EscapeAction
+	// Status messages left out even when not quiet
+	quietExit   bool // "ended"
+	quietDetach bool // "detached" and the like
 	// Escape sequence state (tracks state for each escape char)
 	afterNewline  bool
 	sawEscapeChar byte // The escape char we saw (0 if none)
-	// Terminal ESC sequence tracking (to ignore focus events etc.)
-	inEscSeq bool
+	sawPrefix     byte // Chord prefix held back until the next key (0 if none)
+	// Terminal ESC sequence tracking (to ignore focus events, mouse reports etc.)
+	esc    escState
+	escLen int // Bytes seen since the sequence's introducer
+	escArg int // Numeric CSI parameter (-1 if there's something else)
+	// Inside a bracketed paste, where detach and suspend keys aren't recognized
+	pasting bool
+	// Terminal title handling
+	setTitle bool
+	titleSet bool
+	// Output replayed on attach
+	replay ReplayMode
+	// Alternate screen tracking, so it can be left on detach.
+	// Output is written from its own goroutine, hence the lock.
+	screenMu   sync.Mutex
+	altScreen  bool
+	outputTail []byte // End of the previous output, in case a switch is split
+	// Output decompression (if negotiated)
+	compress    bool
+	inflateW    *io.PipeWriter
+	inflateDone chan struct{}
+	// Suspension (the read deadline must not expire while stopped)
+	suspendMu sync.Mutex
+	suspended bool
+	// Automatic detach (nil timer = never)
+	detachAfter time.Duration
+	detachTimer *time.Timer
 }
 
 // AttachOptions contains options for attaching to a session
 type AttachOptions struct {
 	Quiet            bool
-	SuppressAttached bool        // Don't show "attached" message (for new session)
-	DetachKeys       []DetachKey // Keys/sequences to detach (nil = use default)
+	SuppressAttached bool          // Don't show "attached" message (for new session)
+	SuppressExit     bool          // Don't show the "ended" message when the command exits
+	SuppressDetach   bool          // Don't show the "detached" message
+	DetachKeys       []DetachKey   // Keys/sequences to detach (nil = use default)
+	SuspendKey       byte          // Control key that suspends the client (0 = only escape char + Ctrl+Z)
+	ReadOnly         bool          // Drop input and resizes; only detach keys work
+	Compress         bool          // Ask the server to compress output
+	NoTitle          bool          // Don't set the terminal title to the session name
+	ConnectTimeout   time.Duration // How long to retry connecting (0 = DefaultConnectTimeout)
+	Replay           ReplayMode    // How much buffered output to show on attach
+	DetachAfter      time.Duration // Detach automatically after this long (0 = never)
+	Socket           string        // Connect to this socket instead of the named session's
+	Takeover         bool          // Detach every other attached client
+	Reconnect        bool          // Connect again when the connection is lost (e.g. the server restarted)
+	ReportCwd        bool          // Tell the terminal the session's working directory (OSC 7) on attach
+
+	// What keys typed after the escape char do (nil = DefaultEscapeActions)
+	EscapeActions map[byte]EscapeAction
 }
 
-// Attach connects to an existing session
+// ReplayMode selects how much buffered output is replayed on attach
+type ReplayMode int
+
+const (
+	ReplayFull   ReplayMode = iota // Everything in the server's buffer
+	ReplayScreen                   // About the last screenful (or since the last clear)
+	ReplayNone                     // Nothing; only new output
+)
+
+// ParseReplayMode parses "full", "screen" or "none"
+func ParseReplayMode(s string) (ReplayMode, error) {
+	switch s {
+	case "", "full":
+		return ReplayFull, nil
+	case "screen":
+		return ReplayScreen, nil
+	case "none":
+		return ReplayNone, nil
+	}
+	return 0, fmt.Errorf("invalid replay mode: %q (use full, screen or none)", s)
+}
+
+// Attach connects to an existing session. It returns an error if it can't
+// attach; once attached, the client exits the process itself: with status 0
+// when it detaches, and with the command's exit status when the session ends.
 func Attach(name string, opts AttachOptions) error {
-	if !Exists(name) {
-		return fmt.Errorf("session %q does not exist", name)
+	// Raw mode, input and window sizes all need one
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return ErrNotTerminal
 	}
 
-	sockPath, err := SocketPath(name)
+	if opts.Socket != "" {
+		if err := checkSocket(opts.Socket); err != nil {
+			return err
+		}
+	} else if !IsRemote(name) && !Exists(name) {
+		return fmt.Errorf("session %q does not exist", name)
+	}
+	conn, token, err := dialSession(name, opts.Socket, opts.ConnectTimeout)
 	if err != nil {
 		return err
 	}
-
-	conn, err := net.Dial("unix", sockPath)
-	if err != nil {
-		return fmt.Errorf("failed to connect to session: %w", err)
+	if opts.Reconnect {
+		// The connection is replaced while other goroutines use it
+		conn = &swapConn{conn: conn}
 	}
 
 	detachKeys := opts.DetachKeys
@@ -179,10 +307,27 @@ func Attach(name string, opts AttachOptions) error {
 		conn:         conn,
 		done:         make(chan struct{}),
 		name:         name,
+		token:        token,
+		socket:       opts.Socket,
+		reconnect:    opts.Reconnect,
+		reportCwd:    opts.ReportCwd,
 		quiet:        opts.Quiet,
+		quietExit:    opts.SuppressExit,
+		quietDetach:  opts.SuppressDetach,
+		readOnly:     opts.ReadOnly,
+		compress:     opts.Compress,
+		replay:       opts.Replay,
+		setTitle:     !opts.NoTitle,
 		detachKeys:   detachKeys,
+		suspendKey:   opts.SuspendKey,
+		detachAfter:  opts.DetachAfter,
+		takeover:     opts.Takeover,
 		afterNewline: true, // Start as if we just saw a newline
 	}
+	c.escapeActions = opts.EscapeActions
+	if c.escapeActions == nil {
+		c.escapeActions = DefaultEscapeActions
+	}
 
 	return c.run(!opts.SuppressAttached)
 }
@@ -190,9 +335,43 @@ func Attach(name string, opts AttachOptions) error {
 func (c *Client) run(showAttached bool) error {
 	defer func() { _ = c.conn.Close() }()
 
+	// Make sure we speak the same protocol before touching the terminal
+	flags := HelloAttach
+	if c.compress {
+		flags |= HelloCompress
+	}
+	switch c.replay {
+	case ReplayScreen:
+		flags |= HelloReplayScreen
+	case ReplayNone:
+		flags |= HelloReplayNone
+	}
+	accepted, sessionTerm, err := handshake(c.conn, flags, c.token)
+	if err != nil {
+		return err
+	}
+	c.compress = accepted&HelloCompress != 0
+
+	// Before our size is sent, so the PTY is sized for us alone
+	if c.takeover {
+		if err := writeMessage(c.conn, MsgTakeover, nil); err != nil {
+			return fmt.Errorf("failed to take over: %w", err)
+		}
+	}
+
 	// Show attach message before entering raw mode
 	if showAttached && !c.quiet {
-		fmt.Fprintf(os.Stderr, "[%s: 🔗 attached %q (%s to detach)]\n", AppName, c.name, FormatDetachKeys(c.detachKeys))
+		mode := ""
+		if c.readOnly {
+			mode = " (read-only)"
+		}
+		fmt.Fprintf(os.Stderr, "[%s: 🔗 attached %q%s (%s to detach)]\n", AppName, DisplayName(c.name), mode, FormatDetachKeys(c.detachKeys))
+	}
+	if term := os.Getenv("TERM"); !c.quiet && termColors(term) < termColors(sessionTerm) {
+		if term == "" {
+			term = "unset"
+		}
+		fmt.Fprintf(os.Stderr, "[%s: ⚠️ session expects TERM=%s, but here TERM is %s; output may look wrong]\n", AppName, sessionTerm, term)
 	}
 
 	// Set terminal to raw mode
@@ -203,16 +382,36 @@ func (c *Client) run(showAttached bool) error {
 	c.oldState = oldState
 	defer c.restore()
 
+	// Set the title once; the program inside may change it afterwards
+	c.pushTitle()
+
 	// Send initial window size
 	c.sendWindowSize()
 
+	// The reply comes after the replay, so it wins over directories the
+	// shell reported in there. A remote session's directories aren't here.
+	if c.reportCwd && !IsRemote(c.name) {
+		_ = writeMessage(c.conn, MsgQuery, nil)
+	}
+
+	// A closed output pipe makes writes fail rather than kill the client,
+	// which would leave the terminal in raw mode
+	signal.Ignore(syscall.SIGPIPE)
+
 	// Handle window resize
 	sigwinch := make(chan os.Signal, 1)
 	signal.Notify(sigwinch, syscall.SIGWINCH)
 	go func() {
+		// A drag-resize fires a burst of signals; only the size it ends
+		// with is sent, once the signals stop for resizeDebounce
+		timer := time.NewTimer(resizeDebounce)
+		timer.Stop()
+		defer timer.Stop()
 		for {
 			select {
 			case <-sigwinch:
+				timer.Reset(resizeDebounce)
+			case <-timer.C:
 				c.sendWindowSize()
 			case <-c.done:
 				return
@@ -221,6 +420,29 @@ func (c *Client) run(showAttached bool) error {
 	}()
 	defer signal.Stop(sigwinch)
 
+	// A hangup means the terminal is gone (e.g. the SSH connection
+	// dropped), so detach at once rather than when reading it fails
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		select {
+		case <-hangup:
+			c.hungUp()
+		case <-c.done:
+		}
+	}()
+	defer signal.Stop(hangup)
+
+	// Keep the connection alive and detect dead servers
+	go c.keepalive()
+
+	// Detach on our own once the time is up. Input is blocked reading
+	// stdin, so the client exits from here like it does when the session ends.
+	if c.detachAfter > 0 {
+		c.detachTimer = time.AfterFunc(c.detachAfter, c.doDetach)
+		defer c.detachTimer.Stop()
+	}
+
 	// Handle output from server
 	go c.handleOutput()
 
@@ -228,13 +450,353 @@ func (c *Client) run(showAttached bool) error {
 	return c.handleInput()
 }
 
+// handshake exchanges protocol versions and hello flags with the server.
+// It returns the flags the server accepted and the session's TERM.
+func handshake(conn net.Conn, flags byte, token string) (byte, string, error) {
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	defer func() { _ = conn.SetDeadline(time.Time{}) }()
+
+	hello := append([]byte{ProtocolVersion, flags}, token...)
+	hello = append(hello, 0)
+	hello = append(hello, os.Getenv("TERM")...)
+	if err := writeMessage(conn, MsgHello, hello); err != nil {
+		return 0, "", fmt.Errorf("failed to send hello: %w", err)
+	}
+	msgType, data, err := readMessage(conn)
+	if err != nil {
+		return 0, "", fmt.Errorf("no handshake from session (it may have been created by an older tuck version): %w", err)
+	}
+	switch {
+	case msgType == MsgError:
+		return 0, "", fmt.Errorf("%s", data)
+	case msgType != MsgHello || len(data) < 1:
+		// Servers before the handshake was introduced start with output
+		return 0, "", fmt.Errorf("session was created by an older tuck version; attach with that version or recreate the session")
+	case data[0] != ProtocolVersion:
+		return 0, "", fmt.Errorf("protocol version mismatch (session: %d, client: %d)", data[0], ProtocolVersion)
+	}
+	var accepted byte
+	var term string
+	if len(data) >= 2 {
+		accepted = data[1] & flags
+		term = string(data[2:])
+	}
+	return accepted, term, nil
+}
+
+// termColors estimates how many colors a terminal type supports
+func termColors(term string) int {
+	switch {
+	case term == "":
+		return 0
+	case term == "dumb":
+		return 1
+	case strings.Contains(term, "direct") || strings.Contains(term, "truecolor"):
+		return 1 << 24
+	case strings.Contains(term, "256color"):
+		return 256
+	}
+	return 8
+}
+
+// IsRemote reports whether a session name is a "tcp://[token@]host:port" address
+// of a session listening on TCP
+func IsRemote(name string) bool {
+	return strings.HasPrefix(name, "tcp://")
+}
+
+// DefaultConnectTimeout is how long connecting to a session is retried
+const DefaultConnectTimeout = 2 * time.Second
+
+// ErrNotTerminal means attaching was attempted without a terminal,
+// e.g. from a script or CI job
+var ErrNotTerminal = errors.New("can't attach: stdin is not a terminal")
+
+// ErrStaleSocket means a session's socket file exists but no server is listening on it
+var ErrStaleSocket = errors.New("socket exists but the server is not running (stale session)")
+
+// dial connects to a session's socket, retrying with backoff so that
+// a server that is busy or restarting doesn't cause a spurious failure
+func dial(name string, timeout time.Duration) (net.Conn, error) {
+	network, addr := "tcp", ""
+	if IsRemote(name) {
+		addr, _ = splitRemote(name)
+	} else {
+		sockPath, err := SocketPath(name)
+		if err != nil {
+			return nil, err
+		}
+		network, addr = "unix", sockPath
+	}
+	return dialAddr(name, network, addr, timeout)
+}
+
+// dialAddr connects to a session at the given address, retrying until
+// timeout (0 = DefaultConnectTimeout) while its server may be starting
+func dialAddr(name, network, addr string, timeout time.Duration) (net.Conn, error) {
+	if timeout <= 0 {
+		timeout = DefaultConnectTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	backoff := 50 * time.Millisecond
+	for {
+		conn, err := net.DialTimeout(network, addr, max(time.Until(deadline), backoff))
+		if err == nil {
+			return conn, nil
+		}
+		if network == "unix" && errors.Is(err, syscall.ENOENT) {
+			return nil, fmt.Errorf("session %q does not exist", name)
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			if network == "unix" && errors.Is(err, syscall.ECONNREFUSED) {
+				return nil, fmt.Errorf("session %q: %w", name, ErrStaleSocket)
+			}
+			return nil, fmt.Errorf("failed to connect to session: %w", err)
+		}
+		time.Sleep(backoff)
+		backoff = min(backoff*2, 500*time.Millisecond)
+	}
+}
+
+// SocketName returns the session name a socket path was created for,
+// e.g. "work" for ".../work.sock"
+func SocketName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".sock")
+}
+
+// checkSocket makes sure a path given for attaching is a socket
+func checkSocket(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("socket %q does not exist", path)
+		}
+		return fmt.Errorf("failed to check socket: %w", err)
+	}
+	if info.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("%q is not a socket", path)
+	}
+	return nil
+}
+
+// dialSession connects to a session's server, at the socket path if one is
+// given (the name is then only shown), and returns the token to present
+func dialSession(name, socket string, timeout time.Duration) (net.Conn, string, error) {
+	if socket != "" {
+		conn, err := dialAddr(name, "unix", socket, timeout)
+		return conn, socketToken(socket), err
+	}
+	conn, err := dial(name, timeout)
+	return conn, clientToken(name), err
+}
+
+// connect dials a session's socket and performs the handshake with the
+// given flags, for short-lived connections that don't attach a terminal.
+// Those that don't want the buffered output pass HelloReplayNone, so it
+// isn't streamed to them first.
+func connect(name string, flags byte) (net.Conn, error) {
+	conn, err := dial(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := handshake(conn, flags, clientToken(name)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// request sends a request (e.g. MsgRename) to a running session's server
+// and waits for the reply: empty on success, or the error text. what names
+// the request in errors.
+func request(name string, msgType byte, data []byte, what string) error {
+	conn, err := connect(name, HelloReplayNone)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := writeMessage(conn, msgType, data); err != nil {
+		return fmt.Errorf("failed to send %s request: %w", what, err)
+	}
+
+	// Skip live output until the server replies
+	for {
+		replyType, reply, err := readMessage(conn)
+		if err != nil {
+			return fmt.Errorf("failed to read %s reply: %w", what, err)
+		}
+		if replyType != msgType {
+			continue
+		}
+		if len(reply) > 0 {
+			return fmt.Errorf("%s", reply)
+		}
+		return nil
+	}
+}
+
+// Watch blocks until a session's command exits and returns its exit code.
+// It returns immediately if the session has already exited, and gives up
+// with ctx's error when ctx is done.
+func Watch(ctx context.Context, name string) (int, error) {
+	if !IsRemote(name) && !Exists(name) {
+		if s, err := Load(name); err == nil && s.Exited() {
+			return *s.ExitCode, nil
+		}
+		return 0, fmt.Errorf("session %q does not exist", name)
+	}
+	conn, err := dial(name, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = conn.Close() }()
+	// Earlier output isn't needed
+	if _, _, err := handshake(conn, HelloReplayNone, clientToken(name)); err != nil {
+		return 0, err
+	}
+
+	// Closing the connection interrupts the read below
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-stop:
+		}
+	}()
+
+	// Discard output until the exit notification
+	for {
+		msgType, data, err := readMessage(conn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			return 0, fmt.Errorf("lost connection to session: %w", err)
+		}
+		if msgType == MsgExit {
+			return parseExitPayload(data), nil
+		}
+	}
+}
+
+// Wait blocks until a session's command exits.
+// It returns immediately if the session has already exited.
+func Wait(name string) error {
+	_, err := Watch(context.Background(), name)
+	return err
+}
+
+// Capture returns a session's recent output, as replayed to attaching clients
+func Capture(name string) ([]byte, error) {
+	if !IsRemote(name) && !Exists(name) {
+		return nil, fmt.Errorf("session %q does not exist", name)
+	}
+	conn, err := dial(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	accepted, _, err := handshake(conn, HelloCapture, clientToken(name))
+	if err != nil {
+		return nil, err
+	}
+	if accepted&HelloCapture == 0 {
+		return nil, fmt.Errorf("session was created by an older tuck version that can't capture output")
+	}
+
+	// The server closes the connection after the replay
+	var out []byte
+	for {
+		msgType, data, err := readMessage(conn)
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read output: %w", err)
+		}
+		if msgType == MsgOutput {
+			out = append(out, data...)
+		}
+	}
+}
+
+// Follow writes a session's buffered output to w, then keeps writing new
+// output as it arrives until the session ends. Nothing is sent to the
+// session, and it isn't resized.
+func Follow(name string, w io.Writer) error {
+	if !IsRemote(name) && !Exists(name) {
+		return fmt.Errorf("session %q does not exist", name)
+	}
+	conn, err := connect(name, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	for {
+		msgType, data, err := readMessage(conn)
+		if err != nil {
+			return fmt.Errorf("lost connection to session: %w", err)
+		}
+		switch msgType {
+		case MsgOutput:
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		case MsgExit:
+			return nil
+		}
+	}
+}
+
+// SendInput writes input to a session as if it was typed by an attached client
+func SendInput(name string, data []byte) error {
+	if !IsRemote(name) && !Exists(name) {
+		return fmt.Errorf("session %q does not exist", name)
+	}
+	conn, err := connect(name, HelloReplayNone)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	if err := writeMessage(conn, MsgInput, data); err != nil {
+		return fmt.Errorf("failed to send input: %w", err)
+	}
+	return nil
+}
+
+// restore puts the terminal back the way it was before attaching.
+// It waits for output being written to finish, so after detaching (which
+// stops any more from being written; see lockScreen) what follows, like
+// the detach message, comes after the last of the session's output.
 func (c *Client) restore() {
+	c.screenMu.Lock()
+	defer c.screenMu.Unlock()
+	if c.altScreen {
+		// Leave the program's screen so the prompt comes back
+		fmt.Fprint(os.Stdout, "\x1b[?1049l")
+		c.altScreen = false
+	}
+	if c.titleSet {
+		// Restore the title saved on attach
+		fmt.Fprint(os.Stdout, "\x1b[23;0t")
+		c.titleSet = false
+	}
 	if c.oldState != nil {
 		_ = term.Restore(int(os.Stdin.Fd()), c.oldState)
 	}
 }
 
 func (c *Client) sendWindowSize() {
+	// A read-only viewer shouldn't resize the terminal for everyone else
+	if c.readOnly {
+		return
+	}
 	width, height, err := term.GetSize(int(os.Stdin.Fd()))
 	if err != nil {
 		return
@@ -253,33 +815,268 @@ func (c *Client) handleOutput() {
 		default:
 		}
 
+		c.suspendMu.Lock()
+		if !c.suspended {
+			_ = c.conn.SetReadDeadline(time.Now().Add(pingTimeout))
+		}
+		c.suspendMu.Unlock()
 		msgType, data, err := readMessage(c.conn)
 		if err != nil {
+			select {
+			case <-c.done:
+				// Detached; the connection was closed on purpose
+				return
+			default:
+			}
+			if c.reconnect && c.reconnectSession() {
+				continue
+			}
 			c.close()
-			return
+			c.restore()
+			if !c.quiet {
+				fmt.Fprintf(os.Stderr, "\n[%s: 💔 lost connection to %q]\n", AppName, DisplayName(c.name))
+			}
+			os.Exit(1)
 		}
 
 		switch msgType {
 		case MsgOutput:
-			_, _ = os.Stdout.Write(data)
-			// Track newlines in output for escape sequence detection (like SSH)
-			for _, b := range data {
-				if b == '\n' || b == '\r' {
-					c.afterNewline = true
-					break
-				}
+			c.writeOutput(data)
+		case MsgCompressedOutput:
+			if c.inflateW == nil {
+				c.startInflate()
+			}
+			_, _ = c.inflateW.Write(data)
+		case MsgQuery:
+			c.reportDir(data)
+		case MsgClientCount:
+			if len(data) >= 2 {
+				c.showClientCount(int(binary.BigEndian.Uint16(data)))
+			}
+		case MsgSize:
+			if len(data) >= 4 {
+				c.showSharedSize(binary.BigEndian.Uint16(data[0:2]), binary.BigEndian.Uint16(data[2:4]))
+			}
+		case MsgTakeover:
+			select {
+			case <-c.done:
+				// Detached already
+				return
+			default:
 			}
+			c.takenOver()
 		case MsgExit:
+			select {
+			case <-c.done:
+				// Detached (or ending the session ourselves) already
+				return
+			default:
+			}
+			// If the detach timer already fired, it is restoring the
+			// terminal and exiting; otherwise make sure it never does
+			if c.detachTimer != nil && !c.detachTimer.Stop() {
+				return
+			}
+			// Let pending decompressed output reach the terminal first
+			if c.inflateW != nil {
+				_ = c.inflateW.Close()
+				<-c.inflateDone
+			}
 			// Restore terminal and show message
 			c.restore()
-			if !c.quiet {
-				fmt.Fprintf(os.Stderr, "\n[%s: 🏁 ended %q]\n", AppName, c.name)
+			code := parseExitPayload(data)
+			if !c.quiet && !c.quietExit {
+				if code != 0 {
+					fmt.Fprintf(os.Stderr, "\n[%s: 🏁 ended %q (exit %d)]\n", AppName, DisplayName(c.name), code)
+				} else {
+					fmt.Fprintf(os.Stderr, "\n[%s: 🏁 ended %q]\n", AppName, DisplayName(c.name))
+				}
+			}
+			// Exit with the command's status, so "tuck attach job && deploy" works.
+			// A command whose exit code is unknown has -1.
+			if code < 0 || code > 255 {
+				code = 1
 			}
-			os.Exit(0)
+			os.Exit(code)
+		}
+	}
+}
+
+// Reconnection: how many times to try, and how long to wait before each try
+const (
+	reconnectAttempts = 10
+	reconnectDelay    = time.Second
+)
+
+// reconnectSession connects to the session again after the connection was
+// lost, e.g. because its server restarted, and carries on where it left off.
+// It returns false if the session couldn't be reached.
+func (c *Client) reconnectSession() bool {
+	_ = c.conn.Close()
+	if !c.quiet {
+		fmt.Fprintf(os.Stderr, "\r\n[%s: 🔄 reconnecting to %q…]\r\n", AppName, DisplayName(c.name))
+	}
+	for range reconnectAttempts {
+		time.Sleep(reconnectDelay)
+		select {
+		case <-c.done:
+			return false
+		default:
+		}
+		conn, token, err := dialSession(c.name, c.socket, 0)
+		if err != nil {
+			continue
+		}
+		// The output so far has been shown already
+		flags := HelloAttach | HelloReplayNone
+		if c.compress {
+			flags |= HelloCompress
+		}
+		accepted, _, err := handshake(conn, flags, token)
+		if err != nil {
+			_ = conn.Close()
+			continue
+		}
+		// The new connection starts a new compressed stream
+		if c.inflateW != nil {
+			_ = c.inflateW.Close()
+			<-c.inflateDone
+			c.inflateW = nil
+		}
+		c.compress = accepted&HelloCompress != 0
+		c.token = token
+		c.conn.(*swapConn).set(conn)
+		// A restarted server doesn't know our size, and the resize makes
+		// full-screen programs redraw
+		c.sendWindowSize()
+		return true
+	}
+	return false
+}
+
+// swapConn is a connection that can be replaced by a new one while other
+// goroutines keep using it
+type swapConn struct {
+	mu   sync.RWMutex
+	conn net.Conn
+}
+
+func (s *swapConn) get() net.Conn {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.conn
+}
+
+func (s *swapConn) set(conn net.Conn) {
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+}
+
+func (s *swapConn) Read(b []byte) (int, error)         { return s.get().Read(b) }
+func (s *swapConn) Write(b []byte) (int, error)        { return s.get().Write(b) }
+func (s *swapConn) Close() error                       { return s.get().Close() }
+func (s *swapConn) LocalAddr() net.Addr                { return s.get().LocalAddr() }
+func (s *swapConn) RemoteAddr() net.Addr               { return s.get().RemoteAddr() }
+func (s *swapConn) SetDeadline(t time.Time) error      { return s.get().SetDeadline(t) }
+func (s *swapConn) SetReadDeadline(t time.Time) error  { return s.get().SetReadDeadline(t) }
+func (s *swapConn) SetWriteDeadline(t time.Time) error { return s.get().SetWriteDeadline(t) }
+
+// keepalive pings the server periodically so handleOutput's read deadline
+// is only hit when the server stops responding
+func (c *Client) keepalive() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			_ = writeMessage(c.conn, MsgPing, nil)
 		}
 	}
 }
 
+// lockScreen takes screenMu to write to the terminal. Once detaching has
+// started it returns false without it: output still arriving is dropped
+// (the session keeps it for the next attach) rather than written after the
+// terminal is restored or among the detach message.
+func (c *Client) lockScreen() bool {
+	c.screenMu.Lock()
+	select {
+	case <-c.done:
+		c.screenMu.Unlock()
+		return false
+	default:
+		return true
+	}
+}
+
+// writeOutput writes session output to the terminal
+func (c *Client) writeOutput(data []byte) {
+	if !c.lockScreen() {
+		return
+	}
+	// Write keeps going until everything is written or it fails
+	if _, err := os.Stdout.Write(data); err != nil {
+		c.screenMu.Unlock()
+		c.outputFailed(err)
+		return
+	}
+	scan := append(c.outputTail, data...)
+	c.altScreen = altScreen(scan, c.altScreen)
+	c.outputTail = append(c.outputTail[:0], scan[max(0, len(scan)-maxAltScreenSeq+1):]...)
+	c.screenMu.Unlock()
+
+	// Track newlines in output for escape sequence detection (like SSH)
+	for _, b := range data {
+		if b == '\n' || b == '\r' {
+			c.afterNewline = true
+			break
+		}
+	}
+}
+
+// outputFailed detaches when the output can't be written any more, e.g.
+// when it's piped into a command that has exited, so the terminal isn't
+// left in raw mode
+func (c *Client) outputFailed(err error) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	c.close()
+	c.restore()
+	if !c.quiet {
+		fmt.Fprintf(os.Stderr, "\n[%s: 💔 can't write output (%v), detached %q]\n", AppName, err, DisplayName(c.name))
+	}
+	os.Exit(1)
+}
+
+// startInflate starts decompressing the connection's output stream.
+// Compressed chunks are fed in through inflateW in the order they arrive.
+func (c *Client) startInflate() {
+	pr, pw := io.Pipe()
+	c.inflateW = pw
+	c.inflateDone = make(chan struct{})
+	go func() {
+		defer close(c.inflateDone)
+		r := flate.NewReader(pr)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				c.writeOutput(buf[:n])
+			}
+			if err != nil {
+				_ = pr.CloseWithError(err)
+				return
+			}
+		}
+	}()
+}
+
 func (c *Client) handleInput() error {
 	buf := make([]byte, 1024)
 	for {
@@ -296,31 +1093,89 @@ func (c *Client) handleInput() error {
 
 		// Process input byte by byte for escape sequence detection
 		var toSend []byte
+		flush := func() {
+			if len(toSend) > 0 && !c.readOnly {
+				_ = writeMessage(c.conn, MsgInput, toSend)
+			}
+			toSend = nil
+		}
 		for i := 0; i < n; i++ {
 			b := buf[i]
 
+			// Pasted text is sent as is, so it can't detach by accident
+			if c.pasting {
+				toSend = append(toSend, b)
+				c.trackInput(b)
+				continue
+			}
+
+			// Chords: the prefix is held back until the next key shows
+			// whether it completes one, like tmux's prefix key
+			if c.sawPrefix != 0 {
+				prefix := c.sawPrefix
+				c.sawPrefix = 0
+				if c.isChord(prefix, b) {
+					c.doDetach()
+					return nil
+				}
+				// Not a chord after all; pressing the prefix twice sends it once
+				toSend = append(toSend, prefix)
+				if b == prefix {
+					continue
+				}
+			} else if c.isChordPrefix(b) {
+				c.sawPrefix = b
+				continue
+			}
+
 			// Check for single-key detach (control keys)
 			for _, dk := range c.detachKeys {
-				if !dk.IsEscapeSequence() && b == dk.CtrlKey {
+				if !dk.IsEscapeSequence() && !dk.IsChord() && b == dk.CtrlKey {
 					c.doDetach()
 					return nil
 				}
 			}
 
+			// Check for the suspend key
+			if c.suspendKey != 0 && b == c.suspendKey {
+				flush()
+				c.suspend()
+				continue
+			}
+
 			// Escape sequence state machine
 			if c.sawEscapeChar != 0 {
 				// We previously saw an escape char after a newline
+				esc := c.sawEscapeChar
 				c.sawEscapeChar = 0
-				if b == '.' {
-					// X. = detach
+				switch c.escapeActions[b] {
+				case EscapeDetach:
+					// X. by default
 					c.doDetach()
 					return nil
+				case EscapeSuspend:
+					// X^Z by default (like SSH's ~^Z)
+					flush()
+					c.suspend()
+					continue
+				case EscapeKill:
+					// Xk by default
+					if !c.readOnly {
+						flush()
+						c.doKill()
+						return nil
+					}
+				case EscapeHelp:
+					// X? by default (like SSH's ~?)
+					flush()
+					c.showEscapeHelp(esc)
+					c.afterNewline = true
+					continue
 				}
-				// Not a detach sequence, continue normally
+				// Not an escape command, continue normally
 				toSend = append(toSend, b)
-				// Update newline state based on current char
-				c.afterNewline = (b == '\n' || b == '\r')
-			} else if c.afterNewline && c.isEscapeChar(b) {
+				c.trackInput(b)
+			} else if c.esc == escNone && c.afterNewline && c.isEscapeChar(b) {
 				// Escape char after newline - remember it but still send it
 				c.sawEscapeChar = b
 				toSend = append(toSend, b)
@@ -328,34 +1183,161 @@ func (c *Client) handleInput() error {
 			} else {
 				// Normal character
 				toSend = append(toSend, b)
+				c.trackInput(b)
+			}
+		}
 
-				// Track terminal ESC sequences (like focus events) to ignore them
-				if b == 27 { // ESC
-					c.inEscSeq = true
-				} else if c.inEscSeq {
-					// Check if ESC sequence ends (letter terminates CSI sequences)
-					if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') {
-						c.inEscSeq = false
-					}
-					// Don't update afterNewline while in ESC sequence
-				} else {
-					// Not in ESC sequence - update afterNewline normally
-					if b == '\n' || b == '\r' {
-						c.afterNewline = true
-					} else if b >= 32 && b < 127 {
-						// Printable ASCII - user is typing, reset afterNewline
-						c.afterNewline = false
-					}
+		flush()
+	}
+}
+
+// ctrlZ suspends the client when it follows an escape char
+const ctrlZ = 26
+
+// escState is where the input is in a terminal-generated ESC sequence
+type escState int
+
+const (
+	escNone  escState = iota
+	escStart          // Saw ESC
+	escCSI            // ESC [, until a final byte
+	escSS3            // ESC O, followed by one more byte
+	escMouse          // X10 mouse report: ESC [ M followed by 3 raw bytes
+)
+
+// trackInput follows the input to know whether the user is at the start of
+// a line, where the escape char is recognized. Sequences the terminal sends
+// on its own (keys, focus events, mouse reports) leave that unchanged.
+// The 3 raw bytes of an X10 mouse report can be anything, including CR or
+// the escape char, so they're counted rather than looked at.
+func (c *Client) trackInput(b byte) {
+	switch c.esc {
+	case escStart:
+		switch b {
+		case '[':
+			c.esc, c.escLen, c.escArg = escCSI, 0, 0
+		case 'O':
+			c.esc = escSS3
+		case 27:
+			// ESC ESC, still waiting for the sequence
+		default:
+			// Alt+key
+			c.esc = escNone
+		}
+	case escCSI:
+		switch {
+		case b == 'M' && c.escLen == 0:
+			c.esc, c.escLen = escMouse, 0
+		case b >= 0x40 && b <= 0x7e:
+			// Final byte (SGR mouse reports end with M or m)
+			c.esc = escNone
+			if b == '~' {
+				c.trackPaste()
+			}
+		default:
+			c.escLen++
+			if b >= '0' && b <= '9' && c.escArg >= 0 {
+				c.escArg = c.escArg*10 + int(b-'0')
+				if c.escArg > pasteEnd {
+					// Not a paste marker, and kept from overflowing
+					c.escArg = -1
 				}
+			} else {
+				c.escArg = -1
 			}
 		}
-
-		if len(toSend) > 0 {
-			_ = writeMessage(c.conn, MsgInput, toSend)
+	case escSS3:
+		c.esc = escNone
+	case escMouse:
+		c.escLen++
+		if c.escLen == 3 {
+			c.esc = escNone
+		}
+	default:
+		switch {
+		case b == 27: // ESC
+			c.esc = escStart
+		case b == '\n' || b == '\r':
+			c.afterNewline = true
+		case b >= 32 && b < 127:
+			// Printable ASCII - user is typing, reset afterNewline
+			c.afterNewline = false
 		}
 	}
 }
 
+// suspend stops the client the way Ctrl+Z stops a foreground job,
+// with the terminal restored while it is stopped. On SIGCONT the terminal
+// is set up again and the window size re-sent, as it may have changed.
+func (c *Client) suspend() {
+	c.suspendMu.Lock()
+	c.suspended = true
+	_ = c.conn.SetReadDeadline(time.Time{})
+	c.suspendMu.Unlock()
+
+	c.screenMu.Lock()
+	altScreen := c.altScreen
+	c.screenMu.Unlock()
+	c.restore()
+	if !c.quiet {
+		fmt.Fprintf(os.Stderr, "\n[%s: 💤 suspended %q]\n", AppName, DisplayName(c.name))
+	}
+
+	cont := make(chan os.Signal, 1)
+	signal.Notify(cont, syscall.SIGCONT)
+	_ = syscall.Kill(os.Getpid(), syscall.SIGTSTP)
+	select {
+	case <-cont:
+	case <-time.After(time.Second):
+		// Not stopped, e.g. when the shell has no job control
+	}
+	signal.Stop(cont)
+
+	if oldState, err := term.MakeRaw(int(os.Stdin.Fd())); err == nil {
+		c.oldState = oldState
+	}
+	if altScreen {
+		c.screenMu.Lock()
+		fmt.Fprint(os.Stdout, "\x1b[?1049h")
+		c.altScreen = true
+		c.screenMu.Unlock()
+	}
+	c.pushTitle()
+	c.sendWindowSize()
+	c.afterNewline = true
+
+	c.suspendMu.Lock()
+	c.suspended = false
+	_ = c.conn.SetReadDeadline(time.Now().Add(pingTimeout))
+	c.suspendMu.Unlock()
+}
+
+// pushTitle saves the terminal's title on its title stack (xterm) and sets ours
+func (c *Client) pushTitle() {
+	if !c.setTitle {
+		return
+	}
+	fmt.Fprintf(os.Stdout, "\x1b[22;0t\x1b]0;%s: %s\x07", AppName, DisplayName(c.name))
+	c.titleSet = true
+}
+
+// Bracketed paste markers the terminal wraps pasted text in, once the
+// program has enabled them with ESC [ ? 2004 h
+const (
+	pasteStart = 200 // ESC [ 200 ~
+	pasteEnd   = 201 // ESC [ 201 ~
+)
+
+// trackPaste notes the start and end of a bracketed paste
+func (c *Client) trackPaste() {
+	switch c.escArg {
+	case pasteStart:
+		c.pasting = true
+	case pasteEnd:
+		c.pasting = false
+	}
+}
+
 // isEscapeChar checks if byte is a configured escape character
 func (c *Client) isEscapeChar(b byte) bool {
 	for _, dk := range c.detachKeys {
@@ -366,18 +1348,157 @@ func (c *Client) isEscapeChar(b byte) bool {
 	return false
 }
 
+// isChordPrefix checks if byte is the prefix of a configured chord
+func (c *Client) isChordPrefix(b byte) bool {
+	for _, dk := range c.detachKeys {
+		if dk.IsChord() && dk.CtrlKey == b {
+			return true
+		}
+	}
+	return false
+}
+
+// isChord checks if prefix followed by b is a configured chord
+func (c *Client) isChord(prefix, b byte) bool {
+	for _, dk := range c.detachKeys {
+		if dk.IsChord() && dk.CtrlKey == prefix && dk.Action == b {
+			return true
+		}
+	}
+	return false
+}
+
+// showEscapeHelp lists what can follow the escape char, and the other
+// detach keys. It goes to the terminal only, not to the session.
+func (c *Client) showEscapeHelp(esc byte) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\r\n[%s: escape commands for %q, typed after Enter]\r\n", AppName, DisplayName(c.name))
+	descriptions := map[EscapeAction]string{
+		EscapeDetach:  "detach",
+		EscapeSuspend: "suspend (resume with fg)",
+		EscapeKill:    "detach and end the session",
+		EscapeHelp:    "this help",
+	}
+	for _, action := range []EscapeAction{EscapeDetach, EscapeSuspend, EscapeKill, EscapeHelp} {
+		if action == EscapeKill && c.readOnly {
+			continue
+		}
+		for _, key := range slices.Sorted(maps.Keys(c.escapeActions)) {
+			if c.escapeActions[key] == action {
+				fmt.Fprintf(&b, "  %-4s %s\r\n", string(esc)+formatEscapeKey(key), descriptions[action])
+			}
+		}
+	}
+	var others []DetachKey
+	for _, dk := range c.detachKeys {
+		if !dk.IsEscapeSequence() {
+			others = append(others, dk)
+		}
+	}
+	if len(others) > 0 {
+		fmt.Fprintf(&b, "  Also detach with %s\r\n", FormatDetachKeys(others))
+	}
+	if c.suspendKey != 0 {
+		fmt.Fprintf(&b, "  Also suspend with %s\r\n", formatCtrlKey(c.suspendKey))
+	}
+	fmt.Fprint(os.Stderr, b.String())
+}
+
+// doDetach detaches and exits with status 0, whichever goroutine calls it,
+// so a detach is never mistaken for the end of the session
 func (c *Client) doDetach() {
 	c.close()
 	c.restore()
-	if !c.quiet {
-		fmt.Fprintf(os.Stderr, "\n[%s: 👋 detached %q]\n", AppName, c.name)
+	if !c.quiet && !c.quietDetach {
+		fmt.Fprintf(os.Stderr, "\n[%s: 👋 detached %q]\n", AppName, DisplayName(c.name))
 	}
+	os.Exit(0)
 }
 
-func (c *Client) close() {
-	select {
-	case <-c.done:
-	default:
-		close(c.done)
+// showSharedSize tells the user, right after the attach message, when other
+// clients or a pinned size keep the session smaller than this terminal, so
+// the unused part of the screen isn't a mystery
+func (c *Client) showSharedSize(rows, cols uint16) {
+	width, height, err := term.GetSize(int(os.Stdin.Fd()))
+	if err != nil || c.quiet || (int(rows) >= height && int(cols) >= width) {
+		return
+	}
+	if !c.lockScreen() {
+		return
+	}
+	defer c.screenMu.Unlock()
+	// In raw mode, so the line is ended by hand
+	fmt.Fprintf(os.Stderr, "[%s: 📐 %q is held at %dx%d; this terminal is %dx%d]\r\n",
+		AppName, DisplayName(c.name), cols, rows, width, height)
+}
+
+// reportDir tells the terminal the session's working directory with OSC 7,
+// from the status the server replied with, so e.g. a new tab opens there
+func (c *Client) reportDir(data []byte) {
+	var st Status
+	if err := json.Unmarshal(data, &st); err != nil || st.Cwd == "" {
+		return
 	}
+	host, _ := os.Hostname()
+	if !c.lockScreen() {
+		return
+	}
+	_, _ = os.Stdout.Write(osc7(host, st.Cwd))
+	c.screenMu.Unlock()
+}
+
+// showClientCount tells the user when other clients attach or detach
+// (or that there are some already), as a line between the output
+func (c *Client) showClientCount(n int) {
+	prev := c.clients
+	c.clients = n
+	if c.quiet || n == prev || (prev == 0 && n <= 1) {
+		return
+	}
+	if !c.lockScreen() {
+		return
+	}
+	defer c.screenMu.Unlock()
+	// The line would mess up a full-screen program's screen
+	if c.altScreen {
+		return
+	}
+	clients := "1 client"
+	if n != 1 {
+		clients = fmt.Sprintf("%d clients", n)
+	}
+	fmt.Fprintf(os.Stderr, "\r\n[%s: 👥 %s attached to %q]\r\n", AppName, clients, DisplayName(c.name))
+}
+
+// hungUp detaches like doDetach when the terminal has hung up. There is
+// nothing left to restore or show a message on.
+func (c *Client) hungUp() {
+	c.close()
+	_ = c.conn.Close()
+	os.Exit(0)
+}
+
+// takenOver detaches like doDetach when another client takes the session over
+func (c *Client) takenOver() {
+	c.close()
+	c.restore()
+	if !c.quiet && !c.quietDetach {
+		fmt.Fprintf(os.Stderr, "\n[%s: 👋 detached from %q by takeover]\n", AppName, DisplayName(c.name))
+	}
+	os.Exit(0)
+}
+
+// doKill detaches and asks the server to end the session
+func (c *Client) doKill() {
+	c.close()
+	_ = writeMessage(c.conn, MsgKill, nil)
+	c.restore()
+	if !c.quiet && !c.quietDetach {
+		fmt.Fprintf(os.Stderr, "\n[%s: 🛑 detached and killed %q]\n", AppName, DisplayName(c.name))
+	}
+	os.Exit(0)
+}
+
+func (c *Client) close() {
+	c.closeOnce.Do(func() { close(c.done) })
 }
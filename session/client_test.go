@@ -0,0 +1,63 @@
+package session
+
+import "testing"
+
+// feedInput runs input through trackInput as if it arrived in two reads,
+// split at split
+func feedInput(c *Client, input string, split int) {
+	for _, part := range []string{input[:split], input[split:]} {
+		for i := 0; i < len(part); i++ {
+			c.trackInput(part[i])
+		}
+	}
+}
+
+func TestTrackInputMouse(t *testing.T) {
+	tests := []struct {
+		name         string
+		afterNewline bool // Before the input
+		input        string
+		want         bool // afterNewline after it
+	}{
+		{name: "X10 click after a newline", afterNewline: true, input: "\x1b[M !!", want: true},
+		{name: "X10 click while typing", afterNewline: false, input: "\x1b[M !!", want: false},
+		{name: "X10 with CR in the coordinates", afterNewline: false, input: "\x1b[M \r\r", want: false},
+		{name: "X10 with the escape char in the coordinates", afterNewline: true, input: "\x1b[M ~.", want: true},
+		{name: "X10 with ESC in the coordinates", afterNewline: true, input: "\x1b[M \x1b!", want: true},
+		{name: "two X10 reports", afterNewline: true, input: "\x1b[M !!\x1b[M#!!", want: true},
+		{name: "SGR press and release after a newline", afterNewline: true, input: "\x1b[<0;10;5M\x1b[<0;10;5m", want: true},
+		{name: "SGR while typing", afterNewline: false, input: "\x1b[<0;10;5M", want: false},
+		{name: "SGR wheel", afterNewline: true, input: "\x1b[<64;120;40M", want: true},
+		{name: "typing after X10", afterNewline: true, input: "\x1b[M !!a", want: false},
+		{name: "typing after SGR", afterNewline: true, input: "\x1b[<0;1;1Ma", want: false},
+		{name: "Enter after X10", afterNewline: false, input: "\x1b[M !!\r", want: true},
+		{name: "Enter after SGR", afterNewline: false, input: "\x1b[<0;1;1m\r", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every way the report can be split across two reads
+			for split := 0; split <= len(tt.input); split++ {
+				c := &Client{afterNewline: tt.afterNewline}
+				feedInput(c, tt.input, split)
+				if c.afterNewline != tt.want {
+					t.Errorf("split at %d: afterNewline = %v, want %v", split, c.afterNewline, tt.want)
+				}
+				if c.esc != escNone {
+					t.Errorf("split at %d: still inside a sequence (state %d)", split, c.esc)
+				}
+			}
+		})
+	}
+}
+
+func TestTrackInputMouseThenEscapeChar(t *testing.T) {
+	// A click at the start of a line leaves the escape char recognized there,
+	// and the keys after the click are read as keys
+	for _, report := range []string{"\x1b[M !!", "\x1b[<0;3;4M"} {
+		c := &Client{afterNewline: true, detachKeys: DefaultDetachKeys}
+		feedInput(c, "\r"+report, 1)
+		if c.esc != escNone || !c.afterNewline || !c.isEscapeChar('~') {
+			t.Errorf("after %q: esc = %d, afterNewline = %v; want the escape char recognized", report, c.esc, c.afterNewline)
+		}
+	}
+}
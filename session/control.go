@@ -0,0 +1,254 @@
+package session
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Control mode is a line-based text protocol modelled on a small part of
+// tmux's control mode (tmux -C), so editors and other programs can drive a
+// session over a pipe without a terminal or the binary socket protocol.
+//
+// Lines from tuck:
+//
+//	%session-changed $0 NAME   once connected
+//	%output %0 DATA            session output
+//	%begin TIME NUM 1          start of the reply to a command, then %end,
+//	%end TIME NUM 1            or the error message and %error if it failed
+//	%error TIME NUM 1
+//	%exit [REASON]             the last line: "exited CODE" when the session
+//	                           ended, "detached", or why the connection ended
+//
+// Commands, one per line:
+//
+//	send-keys DATA             send DATA as input
+//	refresh-client -C COLSxROWS
+//	                           set the size of this client (COLS,ROWS also works)
+//	detach-client              detach (so does an empty line or end of input)
+//
+// In DATA, bytes below 0x20 and backslashes are written as a backslash and
+// three octal digits (e.g. \015 for Enter), as tmux does.
+
+// ControlOptions contains options for control mode
+type ControlOptions struct {
+	ReadOnly       bool          // Refuse send-keys and refresh-client
+	ConnectTimeout time.Duration // How long to retry connecting (0 = DefaultConnectTimeout)
+	Replay         ReplayMode    // How much buffered output to send first
+	Socket         string        // Connect to this socket instead of the named session's
+}
+
+// maxControlLine bounds a command line, which may carry pasted input
+const maxControlLine = maxMessageSize
+
+// Control attaches to a session in control mode, reading commands from in
+// and writing notifications to out. It returns the command's exit code once
+// the session ends, or 0 after detaching.
+func Control(name string, opts ControlOptions, in io.Reader, out io.Writer) (int, error) {
+	if opts.Socket != "" {
+		if err := checkSocket(opts.Socket); err != nil {
+			return 0, err
+		}
+	} else if !IsRemote(name) && !Exists(name) {
+		return 0, fmt.Errorf("session %q does not exist", name)
+	}
+	conn, token, err := dialSession(name, opts.Socket, opts.ConnectTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	flags := HelloAttach
+	switch opts.Replay {
+	case ReplayScreen:
+		flags |= HelloReplayScreen
+	case ReplayNone:
+		flags |= HelloReplayNone
+	}
+	if _, _, err := handshake(conn, flags, token); err != nil {
+		return 0, err
+	}
+
+	c := &controlClient{conn: conn, out: out, readOnly: opts.ReadOnly, detached: make(chan struct{})}
+	c.line("%session-changed $0 " + DisplayName(name))
+	go c.handleCommands(in)
+
+	for {
+		msgType, data, err := readMessage(conn)
+		if err != nil {
+			select {
+			case <-c.detached:
+				c.line("%exit detached")
+				return 0, nil
+			default:
+			}
+			c.line("%exit lost connection")
+			return 0, fmt.Errorf("lost connection to session: %w", err)
+		}
+		switch msgType {
+		case MsgOutput:
+			c.line("%output %0 " + controlEscape(data))
+		case MsgTakeover:
+			c.line("%exit detached by takeover")
+			return 0, nil
+		case MsgExit:
+			code := parseExitPayload(data)
+			c.line(fmt.Sprintf("%%exit exited %d", code))
+			return code, nil
+		}
+	}
+}
+
+// controlClient is a session connection in control mode
+type controlClient struct {
+	conn     net.Conn
+	out      io.Writer
+	outMu    sync.Mutex // Notifications and replies are written from two goroutines
+	readOnly bool
+	commands int           // Commands handled, numbering the replies
+	detached chan struct{} // Closed when detaching on purpose
+}
+
+// line writes a line of the protocol
+func (c *controlClient) line(s string) {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	_, _ = io.WriteString(c.out, s+"\n")
+}
+
+// handleCommands runs commands until detaching or the end of input.
+// Detaching closes the connection, which ends Control's read loop.
+func (c *controlClient) handleCommands(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 4096), maxControlLine)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+		// Spaces in send-keys' DATA are kept
+		cmd, args, _ := strings.Cut(strings.TrimLeft(line, " "), " ")
+		err := c.run(cmd, args)
+
+		c.commands++
+		now := time.Now().Unix()
+		c.outMu.Lock()
+		if err != nil {
+			fmt.Fprintf(c.out, "%%begin %d %d 1\n%s\n%%error %d %d 1\n", now, c.commands, err, now, c.commands)
+		} else {
+			fmt.Fprintf(c.out, "%%begin %d %d 1\n%%end %d %d 1\n", now, c.commands, now, c.commands)
+		}
+		c.outMu.Unlock()
+
+		if cmd == "detach-client" {
+			break
+		}
+	}
+	close(c.detached)
+	_ = c.conn.Close()
+}
+
+// run runs a command
+func (c *controlClient) run(cmd, args string) error {
+	switch cmd {
+	case "send-keys":
+		if c.readOnly {
+			return errors.New("read-only client")
+		}
+		data, err := controlUnescape(args)
+		if err != nil {
+			return err
+		}
+		if err := writeMessage(c.conn, MsgInput, data); err != nil {
+			return fmt.Errorf("failed to send input: %w", err)
+		}
+	case "refresh-client":
+		size, ok := strings.CutPrefix(strings.TrimSpace(args), "-C ")
+		if !ok {
+			return errors.New("usage: refresh-client -C COLSxROWS")
+		}
+		if c.readOnly {
+			return errors.New("read-only client")
+		}
+		rows, cols, err := parseControlSize(strings.TrimSpace(size))
+		if err != nil {
+			return err
+		}
+		data := make([]byte, 4)
+		binary.BigEndian.PutUint16(data[0:2], rows)
+		binary.BigEndian.PutUint16(data[2:4], cols)
+		if err := writeMessage(c.conn, MsgResize, data); err != nil {
+			return fmt.Errorf("failed to resize: %w", err)
+		}
+	case "detach-client":
+	default:
+		return fmt.Errorf("unknown command: %s", cmd)
+	}
+	return nil
+}
+
+// parseControlSize parses COLSxROWS or COLS,ROWS
+func parseControlSize(s string) (uint16, uint16, error) {
+	w, h, ok := strings.Cut(s, "x")
+	if !ok {
+		w, h, ok = strings.Cut(s, ",")
+	}
+	cols, err1 := strconv.ParseUint(w, 10, 16)
+	rows, err2 := strconv.ParseUint(h, 10, 16)
+	if !ok || err1 != nil || err2 != nil || cols == 0 || rows == 0 {
+		return 0, 0, fmt.Errorf("invalid size: %q (use COLSxROWS)", s)
+	}
+	return uint16(rows), uint16(cols), nil
+}
+
+// controlEscape writes bytes below 0x20 and backslashes as octal escapes
+func controlEscape(data []byte) string {
+	var b strings.Builder
+	b.Grow(len(data))
+	for _, c := range data {
+		if c < 0x20 || c == '\\' {
+			fmt.Fprintf(&b, "\\%03o", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// controlUnescape reverses controlEscape. Other bytes after a backslash
+// are taken as they are (so \\ is a backslash too).
+func controlUnescape(s string) ([]byte, error) {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			out = append(out, s[i])
+			continue
+		}
+		if i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			n, _ := strconv.ParseUint(s[i+1:i+4], 8, 16)
+			if n > 0xff {
+				return nil, fmt.Errorf("invalid escape: %q", s[i:i+4])
+			}
+			out = append(out, byte(n))
+			i += 3
+			continue
+		}
+		if i+1 >= len(s) {
+			return nil, errors.New("trailing backslash")
+		}
+		out = append(out, s[i+1])
+		i++
+	}
+	return out, nil
+}
+
+func isOctal(b byte) bool {
+	return b >= '0' && b <= '7'
+}
@@ -0,0 +1,102 @@
+package session
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// maxDebugLogSize is how large a debug log gets before it is rotated.
+// One older file is kept (with ".1" appended), so a session's debug logs
+// take up at most twice this.
+const maxDebugLogSize = 1024 * 1024
+
+// debugLogSuffix ends a debug log's file name, after the session name
+const debugLogSuffix = ".debug.log"
+
+// DebugLogPath returns the path of a session's server debug log
+func DebugLogPath(name string) (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+debugLogSuffix), nil
+}
+
+// debugLogSession returns the session a debug log file (or a rotated one)
+// in the data directory belongs to
+func debugLogSession(file string) (string, bool) {
+	file = strings.TrimSuffix(file, ".1")
+	return strings.CutSuffix(file, debugLogSuffix)
+}
+
+// newDebugLogger returns a logger writing to a rotating file at path, or
+// one that discards everything if path is empty. The returned file (nil if
+// there is none) must be closed when the server stops.
+func newDebugLogger(path string) (*slog.Logger, *rotatingFile, error) {
+	if path == "" {
+		return slog.New(slog.DiscardHandler), nil, nil
+	}
+	f, err := openRotating(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	handler := slog.NewTextHandler(f, &slog.HandlerOptions{Level: slog.LevelDebug})
+	return slog.New(handler), f, nil
+}
+
+// rotatingFile appends to a file, moving it aside once it would grow past
+// maxDebugLogSize
+type rotatingFile struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File // nil if reopening after a rotation failed
+	size int64
+}
+
+func openRotating(path string) (*rotatingFile, error) {
+	f, err := openAppend(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &rotatingFile{path: path, f: f, size: info.Size()}, nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f != nil && r.size > 0 && r.size+int64(len(p)) > maxDebugLogSize {
+		_ = r.f.Close()
+		_ = os.Rename(r.path, r.path+".1")
+		f, err := openAppend(r.path)
+		if err != nil {
+			r.f = nil
+			return 0, err
+		}
+		r.f, r.size = f, 0
+	}
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
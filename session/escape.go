@@ -0,0 +1,88 @@
+package session
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// EscapeAction is what a key typed after the escape char does, like the
+// commands after ~ in SSH
+type EscapeAction int
+
+const (
+	EscapeNone    EscapeAction = iota // Sent to the session like any other key
+	EscapeDetach                      // Detach
+	EscapeSuspend                     // Suspend the client (resume with fg)
+	EscapeKill                        // Detach and end the session
+	EscapeHelp                        // List the escape commands
+)
+
+// escapeActionNames are the names ParseEscapeActions accepts, by action
+var escapeActionNames = []string{"none", "detach", "suspend", "kill", "help"}
+
+func (a EscapeAction) String() string {
+	if a < 0 || int(a) >= len(escapeActionNames) {
+		return fmt.Sprintf("EscapeAction(%d)", int(a))
+	}
+	return escapeActionNames[a]
+}
+
+// DefaultEscapeActions are the keys recognized after the escape char
+var DefaultEscapeActions = map[byte]EscapeAction{
+	'.':   EscapeDetach,
+	ctrlZ: EscapeSuspend,
+	'k':   EscapeKill,
+	'?':   EscapeHelp,
+}
+
+// ParseEscapeActions returns DefaultEscapeActions with bindings given as
+// KEY=ACTION applied on top, e.g. "x=kill" or "k=none". KEY is a printable
+// character or a control key (ctrl-x, C-x, ^x); ACTION is detach, suspend,
+// kill, help or none. The period always detaches, since that is what the
+// escape sequences the detach keys name (like ~.) do.
+func ParseEscapeActions(specs []string) (map[byte]EscapeAction, error) {
+	actions := maps.Clone(DefaultEscapeActions)
+	for _, spec := range specs {
+		// Split at the last '=', so '=' itself can be bound
+		i := strings.LastIndexByte(spec, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid escape action: %q (use KEY=ACTION, like x=kill)", spec)
+		}
+		key, ok := parseEscapeKey(spec[:i])
+		if !ok {
+			return nil, fmt.Errorf("invalid escape action key: %q (use a printable character or a control key like ctrl-x)", spec[:i])
+		}
+		action := EscapeAction(slices.Index(escapeActionNames, strings.ToLower(spec[i+1:])))
+		if action < 0 {
+			return nil, fmt.Errorf("invalid escape action: %q (use detach, suspend, kill, help or none)", spec[i+1:])
+		}
+		if key == '.' && action != EscapeDetach {
+			return nil, fmt.Errorf("invalid escape action: %q (the period always detaches)", spec)
+		}
+		if action == EscapeNone {
+			delete(actions, key)
+		} else {
+			actions[key] = action
+		}
+	}
+	return actions, nil
+}
+
+// parseEscapeKey parses a key that can follow the escape char
+func parseEscapeKey(s string) (byte, bool) {
+	if len(s) == 1 && s[0] > ' ' && s[0] < 127 {
+		return s[0], true
+	}
+	return parseCtrlArg(s)
+}
+
+// formatEscapeKey shows a key that follows the escape char, with control
+// keys in caret notation (^Z)
+func formatEscapeKey(key byte) string {
+	if key < ' ' {
+		return fmt.Sprintf("^%c", key+'@')
+	}
+	return string(key)
+}
@@ -0,0 +1,126 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Event types
+const (
+	EventCreated  = "created"
+	EventExited   = "exited"
+	EventAttached = "attached"
+	EventDetached = "detached"
+)
+
+// Event is a session lifecycle event, as written to the event log
+type Event struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"event"`
+	Session  string    `json:"session"`
+	ExitCode *int      `json:"exit_code,omitempty"` // For exited events, if the command exited by itself
+}
+
+// maxEventsSize is the size past which the event log is started over
+const maxEventsSize = 1024 * 1024
+
+// eventsPollInterval is how often FollowEvents checks for new events
+const eventsPollInterval = 200 * time.Millisecond
+
+// EventsPath returns the path of the event log shared by all servers
+func EventsPath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "events.log"), nil
+}
+
+// appendEvent adds an event to the event log. Errors are ignored, since
+// events are only informational.
+func appendEvent(typ, name string, exitCode *int) {
+	path, err := EventsPath()
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(Event{Time: time.Now(), Type: typ, Session: name, ExitCode: exitCode})
+	if err != nil {
+		return
+	}
+	flags := os.O_WRONLY | os.O_APPEND | os.O_CREATE
+	if info, err := os.Stat(path); err == nil && info.Size() > maxEventsSize {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return
+	}
+	// A single write of a line keeps concurrent servers from interleaving
+	_, _ = f.Write(append(data, '\n'))
+	_ = f.Close()
+}
+
+// FollowEvents calls fn for every event logged from now on, until fn returns false
+func FollowEvents(fn func(Event) bool) error {
+	if _, err := EnsureDataDir(); err != nil {
+		return err
+	}
+	path, err := EventsPath()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open event log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to read event log: %w", err)
+	}
+	var pending []byte
+	buf := make([]byte, 32*1024)
+	for {
+		// Start over if the log was truncated
+		if info, err := os.Stat(path); err == nil && info.Size() < offset {
+			if offset, err = f.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to read event log: %w", err)
+			}
+			pending = nil
+		}
+
+		n, err := f.Read(buf)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read event log: %w", err)
+		}
+		if n == 0 {
+			time.Sleep(eventsPollInterval)
+			continue
+		}
+		offset += int64(n)
+		pending = append(pending, buf[:n]...)
+
+		for {
+			i := bytes.IndexByte(pending, '\n')
+			if i < 0 {
+				break
+			}
+			line := pending[:i]
+			pending = pending[i+1:]
+			var ev Event
+			if json.Unmarshal(line, &ev) != nil {
+				continue
+			}
+			if !fn(ev) {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+)
+
+// namedKeys maps key names accepted by ParseKeys to the bytes they send
+var namedKeys = map[string]string{
+	"enter":     "\r",
+	"tab":       "\t",
+	"space":     " ",
+	"escape":    "\x1b",
+	"esc":       "\x1b",
+	"bspace":    "\x7f",
+	"backspace": "\x7f",
+	"up":        "\x1b[A",
+	"down":      "\x1b[B",
+	"right":     "\x1b[C",
+	"left":      "\x1b[D",
+	"home":      "\x1b[H",
+	"end":       "\x1b[F",
+}
+
+// ParseKeys converts key arguments to the bytes to send to a session.
+// Each argument is either:
+//   - a key name: "Enter", "Tab", "Escape", "Up", ... (case-insensitive)
+//   - a control key: "C-c", "ctrl-c", "^c"
+//   - literal text, with \n, \r, \t, \e and \\ escapes
+func ParseKeys(args []string) ([]byte, error) {
+	var out []byte
+	for _, arg := range args {
+		if arg == "" {
+			continue
+		}
+		if seq, ok := namedKeys[strings.ToLower(arg)]; ok {
+			out = append(out, seq...)
+			continue
+		}
+		if key, ok := parseCtrlArg(arg); ok {
+			out = append(out, key)
+			continue
+		}
+		text, err := unescapeKeys(arg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, text...)
+	}
+	return out, nil
+}
+
+// parseCtrlArg parses "C-x", "ctrl-x" and "^x" key arguments
+func parseCtrlArg(s string) (byte, bool) {
+	for _, prefix := range []string{"C-", "ctrl-", "Ctrl-", "^"} {
+		if len(s) > len(prefix) && strings.HasPrefix(s, prefix) {
+			return parseCtrlChar(s[len(prefix):])
+		}
+	}
+	return 0, false
+}
+
+// unescapeKeys expands backslash escapes in literal key text
+func unescapeKeys(s string) ([]byte, error) {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			out = append(out, s[i])
+			continue
+		}
+		if i+1 >= len(s) {
+			return nil, fmt.Errorf("invalid keys %q: trailing backslash", s)
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'e':
+			out = append(out, 0x1b)
+		case '\\':
+			out = append(out, '\\')
+		default:
+			return nil, fmt.Errorf("invalid keys %q: unknown escape \\%c", s, s[i])
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,76 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrNotExist means there is no session info for the given name
+	ErrNotExist = errors.New("session does not exist")
+	// ErrNotRunning means the session's server is no longer running
+	ErrNotRunning = errors.New("session is not running")
+)
+
+// killTimeout is how long Kill waits for the server, allowing a full grace
+// period for each signal the server sends its command
+const killTimeout = 3*killGrace + time.Second
+
+// Signal sends a signal to a session's server process.
+// SIGTERM, SIGHUP and SIGINT make the server end its command gracefully.
+func Signal(name string, sig syscall.Signal) error {
+	sess, err := Load(name)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrNotExist, name)
+	}
+	if sess.Exited() || sess.PID <= 0 || !isProcessRunning(sess.PID) {
+		return fmt.Errorf("%w: %s", ErrNotRunning, name)
+	}
+	proc, err := os.FindProcess(sess.PID)
+	if err != nil {
+		return fmt.Errorf("failed to find session process: %w", err)
+	}
+	if err := proc.Signal(sig); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			return fmt.Errorf("%w: %s", ErrNotRunning, name)
+		}
+		return fmt.Errorf("failed to signal session: %w", err)
+	}
+	return nil
+}
+
+// Kill asks a session's server to end its command gracefully and waits
+// for the server to exit before removing the session's files
+func Kill(name string) error {
+	err := Signal(name, syscall.SIGTERM)
+	switch {
+	case errors.Is(err, ErrNotExist):
+		if !socketExists(name) {
+			return fmt.Errorf("session %q does not exist", name)
+		}
+		// Stale socket without session info; there is no process to kill
+		return Remove(name)
+	case errors.Is(err, ErrNotRunning):
+		return Remove(name)
+	case err != nil:
+		return err
+	}
+
+	sess, err := Load(name)
+	if err != nil {
+		// Already cleaned up by the server
+		return Remove(name)
+	}
+	// The socket goes away once the server has shut down
+	deadline := time.Now().Add(killTimeout)
+	for Exists(name) && isProcessRunning(sess.PID) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("session %q did not exit within %s", name, killTimeout)
+		}
+		sleepMs(100)
+	}
+	return Remove(name)
+}
@@ -0,0 +1,87 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockWriteGrace is how long a lock file may stay empty while its creator
+// writes its PID; an empty one older than that was left by a crash
+const lockWriteGrace = 5 * time.Second
+
+// LockPath returns the path of the lock file a session's server holds
+func LockPath(name string) (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".lock"), nil
+}
+
+// acquireLock claims a session name for this process. The lock file is
+// created exclusively, so when servers for the same name start at once,
+// only one of them gets it. A lock left behind by a dead server is taken over.
+func acquireLock(name string) error {
+	path, err := LockPath(name)
+	if err != nil {
+		return err
+	}
+	for range 2 {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d", os.Getpid())
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				_ = os.Remove(path)
+				return fmt.Errorf("failed to write lock: %w", err)
+			}
+			return nil
+		}
+		if !os.IsExist(err) {
+			return fmt.Errorf("failed to create lock: %w", err)
+		}
+		if !staleLock(path) {
+			break
+		}
+		_ = os.Remove(path)
+	}
+	return fmt.Errorf("session %q already exists", name)
+}
+
+// releaseLock removes a session's lock if this process holds it
+func releaseLock(name string) {
+	path, err := LockPath(name)
+	if err != nil {
+		return
+	}
+	if pid, ok := lockHolder(path); ok && pid == os.Getpid() {
+		_ = os.Remove(path)
+	}
+}
+
+// lockHolder returns the PID written to a lock file.
+// ok is false if there is no lock or the PID isn't written yet.
+func lockHolder(path string) (pid int, ok bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	pid, err = strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid, err == nil && pid > 0
+}
+
+// staleLock reports whether a lock file was left behind by a process
+// that is no longer running
+func staleLock(path string) bool {
+	if pid, ok := lockHolder(path); ok {
+		return !isProcessRunning(pid)
+	}
+	info, err := os.Stat(path)
+	return err == nil && time.Since(info.ModTime()) >= lockWriteGrace
+}
@@ -0,0 +1,136 @@
+package session
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxLogLine bounds the characters a logNormalizer holds for one line.
+// Output that never ends a line (e.g. a full-screen program's) is written
+// out as it is once it gets that long.
+const maxLogLine = 64 * 1024
+
+// logNormalizer writes output to a log file the way a terminal would show
+// each line once it's done: text after a carriage return or backspace
+// overwrites what was there, so a progress bar leaves its final state
+// rather than every update run together on one giant line. Escape
+// sequences are kept, taking no space; one that erases the rest of the
+// line (ESC [ K) does so.
+type logNormalizer struct {
+	mu      sync.Mutex // Output is written from the PTY's goroutine, and closed on shutdown
+	w       io.WriteCloser
+	line    [][]byte // Characters of the current line, each with the escape sequences before it
+	col     int      // Where the next character goes in line
+	prefix  []byte   // Escape sequences waiting for the next character
+	pending []byte   // Start of a character or escape sequence cut off by the previous write
+}
+
+func newLogNormalizer(w io.WriteCloser) *logNormalizer {
+	return &logNormalizer{w: w}
+}
+
+func (n *logNormalizer) Write(data []byte) (int, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	size := len(data)
+	if len(n.pending) > 0 {
+		data = append(n.pending, data...)
+		n.pending = nil
+	}
+	for i := 0; i < len(data); {
+		b := data[i]
+		switch {
+		case b == '\n':
+			if err := n.flush(); err != nil {
+				return size, err
+			}
+			i++
+		case b == '\r':
+			n.col = 0
+			i++
+		case b == '\b':
+			n.col = max(0, n.col-1)
+			i++
+		case b == 0x1b:
+			end := escEnd(data, i)
+			if end == len(data) && end-i < maxEscLookback {
+				// Possibly cut off; wait for the rest
+				n.pending = bytes.Clone(data[i:])
+				return size, nil
+			}
+			seq := data[i:end]
+			if isEraseLine(seq) {
+				n.line = n.line[:min(n.col, len(n.line))]
+			}
+			n.prefix = append(n.prefix, seq...)
+			i = end
+		case b < 0x20 && b != '\t':
+			// Other control characters (e.g. BEL) take no space either
+			n.prefix = append(n.prefix, b)
+			i++
+		default:
+			if !utf8.FullRune(data[i:]) {
+				n.pending = bytes.Clone(data[i:])
+				return size, nil
+			}
+			_, w := utf8.DecodeRune(data[i:])
+			n.put(data[i : i+w])
+			i += w
+		}
+	}
+	if len(n.line) >= maxLogLine {
+		if _, err := n.w.Write(n.take()); err != nil {
+			return size, err
+		}
+	}
+	return size, nil
+}
+
+// put writes a character at the current column
+func (n *logNormalizer) put(ch []byte) {
+	cell := append(n.prefix, ch...)
+	n.prefix = nil
+	if n.col < len(n.line) {
+		n.line[n.col] = cell
+	} else {
+		n.line = append(n.line, cell)
+	}
+	n.col++
+}
+
+// take returns the current line's bytes and starts a new line
+func (n *logNormalizer) take() []byte {
+	var out []byte
+	for _, cell := range n.line {
+		out = append(out, cell...)
+	}
+	out = append(out, n.prefix...)
+	n.line, n.col, n.prefix = n.line[:0], 0, nil
+	return out
+}
+
+// flush writes out the finished line
+func (n *logNormalizer) flush() error {
+	_, err := n.w.Write(append(n.take(), '\n'))
+	return err
+}
+
+// Close writes out what's left of the last line and closes the log file
+func (n *logNormalizer) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	out := append(n.take(), n.pending...)
+	n.pending = nil
+	if len(out) > 0 {
+		_, _ = n.w.Write(out)
+	}
+	return n.w.Close()
+}
+
+// isEraseLine reports whether seq erases from the cursor to the end of
+// the line (ESC [ K or ESC [ 0 K)
+func isEraseLine(seq []byte) bool {
+	return bytes.Equal(seq, []byte("\x1b[K")) || bytes.Equal(seq, []byte("\x1b[0K"))
+}
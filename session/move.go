@@ -0,0 +1,35 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Move changes the working directory recorded for a session, as shown by
+// "tuck list". Only the label changes; the command keeps running where it
+// is. A running server is asked to make the change, as it would otherwise
+// write its own copy of the info over it.
+func Move(name, dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("invalid directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("invalid directory: %s is not a directory", dir)
+	}
+
+	sess, err := Load(name)
+	if err != nil {
+		return fmt.Errorf("session %q does not exist", name)
+	}
+	if sess.Exited() || !isProcessRunning(sess.PID) {
+		sess.Dir = dir
+		return sess.Save()
+	}
+	return request(name, MsgMove, []byte(dir), "move")
+}
@@ -0,0 +1,113 @@
+package session
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Name schemes for generated session names
+const (
+	NameSchemeDir       = "dir"       // Base name of the current directory (default)
+	NameSchemeTimestamp = "timestamp" // Creation time, e.g. 20240101-153000
+	NameSchemeRandom    = "random"    // Adjective-noun pair, e.g. brave-otter
+)
+
+// DefaultName is used when no better name can be generated
+const DefaultName = "session"
+
+var (
+	nameAdjectives = []string{
+		"amber", "bold", "brave", "bright", "calm", "clever", "cosy", "crisp",
+		"eager", "fancy", "gentle", "happy", "jolly", "keen", "kind", "lively",
+		"lucky", "merry", "mild", "nimble", "polite", "proud", "quick", "quiet",
+		"rapid", "shy", "silent", "sleepy", "smooth", "snug", "steady", "sunny",
+		"swift", "tidy", "witty", "young", "zesty",
+	}
+	nameNouns = []string{
+		"badger", "beaver", "bison", "crane", "falcon", "ferret", "finch",
+		"fox", "gecko", "heron", "ibis", "koala", "lemur", "lynx", "marmot",
+		"marten", "mole", "moose", "newt", "otter", "owl", "panda", "puffin",
+		"quail", "raven", "robin", "seal", "sloth", "stoat", "swan", "tapir",
+		"toad", "walrus", "wombat", "wren", "yak",
+	}
+)
+
+// ValidateNameScheme checks that a name scheme is known.
+// An empty scheme means the default.
+func ValidateNameScheme(scheme string) error {
+	switch scheme {
+	case "", NameSchemeDir, NameSchemeTimestamp, NameSchemeRandom:
+		return nil
+	}
+	return fmt.Errorf("invalid name scheme: %q (use dir, timestamp or random)", scheme)
+}
+
+// GenerateName returns a name for a new session using the given scheme
+// (NameSchemeDir if empty or unknown). The name doesn't clash with a
+// running session; a number is appended if needed.
+func GenerateName(scheme string) string {
+	var base string
+	switch scheme {
+	case NameSchemeTimestamp:
+		base = time.Now().Format("20060102-150405")
+	case NameSchemeRandom:
+		// Another pair is likelier to read well than a numbered one
+		for range 10 {
+			base = randomName()
+			if nameAvailable(base) {
+				return base
+			}
+		}
+	default:
+		base = dirName()
+	}
+
+	// If base name is available, use it
+	if nameAvailable(base) {
+		return base
+	}
+
+	// Otherwise, append a number
+	for i := 1; i < 1000; i++ {
+		name := fmt.Sprintf("%s-%d", base, i)
+		if nameAvailable(name) {
+			return name
+		}
+	}
+	return base
+}
+
+// dirName returns the base name of the current directory, or DefaultName
+// if that can't be used (e.g. "/" or a directory name with a colon)
+func dirName() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return DefaultName
+	}
+	base := filepath.Base(cwd)
+	if ValidateName(base) != nil {
+		return DefaultName
+	}
+	return base
+}
+
+// randomName returns a random adjective-noun pair
+func randomName() string {
+	return nameAdjectives[rand.IntN(len(nameAdjectives))] + "-" + nameNouns[rand.IntN(len(nameNouns))]
+}
+
+// nameAvailable reports whether a generated name can be used, cleaning up
+// after a session that crashed under it so the name is reused
+func nameAvailable(name string) bool {
+	if !Exists(name) {
+		return true
+	}
+	if Stale(name) {
+		_ = Remove(name)
+		return true
+	}
+	return false
+}
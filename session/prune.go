@@ -0,0 +1,96 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Prune removes files left behind by sessions that are gone: the info of
+// sessions whose process died or whose command exited over a day ago
+// (see exitedKeep), sockets nobody listens on, locks of dead
+// servers and error files from failed starts. With logs, the output logs,
+// recordings and replay buffer snapshots of sessions that no longer exist
+// are removed too. It returns the removed paths.
+func Prune(logs bool) ([]string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+	eventsPath, err := EventsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	// Work out which sessions are still around before removing anything
+	type state struct {
+		dead    bool // Has info, but its process is gone without having exited, or it exited long ago
+		kept    bool // Has info that stays
+		stale   bool // Has a socket nobody listens on
+		serving bool // Has a socket a server listens on
+	}
+	states := make(map[string]*state)
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ext)
+		st := states[name]
+		if st == nil {
+			st = &state{}
+			states[name] = st
+		}
+		switch ext {
+		case ".json":
+			s, err := Load(name)
+			// Info that can't be read may be mid-write, so leave it
+			st.dead = err == nil && (s.expired() || (!s.Exited() && !isProcessRunning(s.PID)))
+			st.kept = !st.dead
+		case ".sock":
+			st.stale = staleSocket(name)
+			st.serving = !st.stale
+		}
+	}
+
+	var removed []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		st := states[strings.TrimSuffix(entry.Name(), ext)]
+		path := filepath.Join(dir, entry.Name())
+		if name, ok := debugLogSession(entry.Name()); ok {
+			// Debug logs go with the session they're named after, like its log
+			ext, st = ".log", states[name]
+			if st == nil {
+				st = &state{}
+			}
+		}
+
+		var remove bool
+		switch ext {
+		case ".json":
+			remove = st.dead
+		case ".sock":
+			remove = st.stale
+		case ".err":
+			remove = !st.kept && !st.serving
+		case ".lock":
+			remove = staleLock(path)
+		case ".log", ".rec", ".buf":
+			remove = logs && !st.kept && !st.serving && path != eventsPath
+		}
+		if !remove {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
@@ -1,49 +1,215 @@
 package session
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
 
 	"github.com/creack/pty"
 )
 
-// PTY represents a pseudo-terminal
+// PTY represents a pseudo-terminal.
+// File and Cmd are replaced by Restart, so they are accessed through methods.
 type PTY struct {
 	File *os.File
 	Cmd  *exec.Cmd
+
+	mu      sync.Mutex
+	command []string
+	opts    PTYOptions
 }
 
+// PTYOptions contains options for starting a command in a PTY
+type PTYOptions struct {
+	Dir   string   // Working directory (empty = inherit)
+	Env   []string // Extra KEY=VALUE pairs, overriding the inherited environment
+	Shell string   // Shell to run when no command is given ($TUCK_SHELL overrides; empty = $SHELL)
+	Term  string   // TERM for the command (empty = inherited, or DefaultTerm if unset)
+	Rows  uint16   // Initial size (0 = the PTY's default)
+	Cols  uint16
+
+	// ViaShell runs the command as "shell -lc <command>", so the user's
+	// profile, functions and aliases apply
+	ViaShell bool
+}
+
+// DefaultTerm is the TERM given to commands when tuck itself has none
+const DefaultTerm = "xterm-256color"
+
 // StartPTY starts a command in a new PTY
-func StartPTY(sessionName string, command []string) (*PTY, error) {
+func StartPTY(sessionName string, command []string, opts PTYOptions) (*PTY, error) {
+	cmd, err := newCommand(sessionName, command, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start the command with a PTY, at the given size if any, so it
+	// doesn't draw for the default size first
+	var size *pty.Winsize
+	if opts.Rows > 0 && opts.Cols > 0 {
+		size = &pty.Winsize{Rows: opts.Rows, Cols: opts.Cols}
+	}
+	ptmx, err := pty.StartWithSize(cmd, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PTY{
+		File:    ptmx,
+		Cmd:     cmd,
+		command: command,
+		opts:    opts,
+	}, nil
+}
+
+// Restart runs the command again in a fresh PTY of the same size.
+// The previous command must have exited.
+func (p *PTY) Restart(sessionName string) error {
+	old := p.file()
+	size, err := pty.GetsizeFull(old)
+	if err != nil {
+		size = nil
+	}
+	cmd, err := newCommand(sessionName, p.command, p.opts)
+	if err != nil {
+		return err
+	}
+	ptmx, err := pty.StartWithSize(cmd, size)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.File, p.Cmd = ptmx, cmd
+	p.mu.Unlock()
+	_ = old.Close()
+	return nil
+}
+
+// ResolveShell picks the shell to run: $TUCK_SHELL, then the configured
+// one, then $SHELL and finally /bin/sh. $TUCK_SHELL comes first so tuck can
+// be pointed elsewhere when $SHELL is e.g. a restricted shell.
+func ResolveShell(configured string) (string, error) {
+	shell := os.Getenv("TUCK_SHELL")
+	if shell == "" {
+		shell = configured
+	}
+	if shell == "" {
+		shell = os.Getenv("SHELL")
+	}
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	// Fail here with a clear error rather than with a session that ends at once
+	if _, err := exec.LookPath(shell); err != nil {
+		return "", fmt.Errorf("invalid shell %q: %w", shell, err)
+	}
+	return shell, nil
+}
+
+// CheckPTY makes sure a pseudo-terminal can be allocated, which fails
+// e.g. in containers without /dev/pts
+func CheckPTY() error {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return err
+	}
+	_ = tty.Close()
+	_ = ptmx.Close()
+	return nil
+}
+
+// shellJoin joins command arguments into a single shell command line,
+// quoting any argument the shell would otherwise split or expand.
+// Plain words are left alone so the command name can still be an alias.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-+=.,:/@%") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// newCommand prepares the command to run in a session's PTY
+func newCommand(sessionName string, command []string, opts PTYOptions) (*exec.Cmd, error) {
 	var cmd *exec.Cmd
-	if len(command) == 0 {
-		shell := os.Getenv("SHELL")
-		if shell == "" {
-			shell = "/bin/sh"
+	if len(command) == 0 || opts.ViaShell {
+		shell, err := ResolveShell(opts.Shell)
+		if err != nil {
+			return nil, err
+		}
+		if len(command) == 0 {
+			cmd = exec.Command(shell)
+		} else {
+			cmd = exec.Command(shell, "-lc", shellJoin(command))
 		}
-		cmd = exec.Command(shell)
 	} else {
 		cmd = exec.Command(command[0], command[1:]...)
 	}
 
-	// Set up environment with TUCK_SESSION to prevent nesting
-	cmd.Env = append(os.Environ(), "TUCK_SESSION="+sessionName)
+	cmd.Dir = opts.Dir
 
-	// Start the command with a PTY
-	ptmx, err := pty.Start(cmd)
-	if err != nil {
-		return nil, err
+	// Set up environment with TUCK_SESSION to prevent nesting.
+	// TUCK_SERVER is dropped so a tuck run inside the session isn't mistaken for a server.
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "TUCK_SERVER=") {
+			env = append(env, kv)
+		}
 	}
+	env = append(env, opts.Env...)
+	// Without TERM, programs in the session can't drive the terminal.
+	// A TERM inherited or passed with Env is kept unless overridden.
+	if opts.Term != "" {
+		env = append(env, "TERM="+opts.Term)
+	} else if lookupEnv(env, "TERM") == "" {
+		env = append(env, "TERM="+DefaultTerm)
+	}
+	cmd.Env = append(env, "TUCK_SESSION="+sessionName)
+	return cmd, nil
+}
 
-	return &PTY{
-		File: ptmx,
-		Cmd:  cmd,
-	}, nil
+// file returns the current PTY master
+func (p *PTY) file() *os.File {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.File
+}
+
+// cmd returns the current command
+func (p *PTY) cmd() *exec.Cmd {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Cmd
+}
+
+// Write writes input to the current PTY
+func (p *PTY) Write(data []byte) (int, error) {
+	return p.file().Write(data)
+}
+
+// lookupEnv returns the value of key in env, where later entries win
+func lookupEnv(env []string, key string) string {
+	value := ""
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, key+"="); ok {
+			value = v
+		}
+	}
+	return value
 }
 
 // Resize resizes the PTY
 func (p *PTY) Resize(rows, cols uint16) error {
-	return pty.Setsize(p.File, &pty.Winsize{
+	return pty.Setsize(p.file(), &pty.Winsize{
 		Rows: rows,
 		Cols: cols,
 	})
@@ -51,10 +217,44 @@ func (p *PTY) Resize(rows, cols uint16) error {
 
 // Close closes the PTY
 func (p *PTY) Close() error {
-	return p.File.Close()
+	return p.file().Close()
 }
 
-// Wait waits for the command to finish
+// Wait waits for the current command to finish
 func (p *PTY) Wait() error {
-	return p.Cmd.Wait()
+	return p.cmd().Wait()
+}
+
+// Pgid returns the command's process group ID.
+// pty.Start runs the command as a session leader (setsid), which already
+// puts it in a process group of its own, so this is simply its PID.
+func (p *PTY) Pgid() int {
+	return p.cmd().Process.Pid
+}
+
+// Signal sends a signal to the command's process group and to the
+// terminal's foreground process group, which differs when a shell is
+// running a job
+func (p *PTY) Signal(sig syscall.Signal) {
+	pgid := p.Pgid()
+	_ = syscall.Kill(-pgid, sig)
+
+	var fg int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, p.file().Fd(), uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&fg)))
+	if errno == 0 && fg > 0 && int(fg) != pgid {
+		_ = syscall.Kill(-int(fg), sig)
+	}
+}
+
+// ExitCode returns the exit code of the finished command, or -1 if unknown.
+// A command killed by a signal gets 128 plus the signal number, as in shells.
+func (p *PTY) ExitCode() int {
+	cmd := p.cmd()
+	if cmd.ProcessState == nil {
+		return -1
+	}
+	if ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return cmd.ProcessState.ExitCode()
 }
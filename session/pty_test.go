@@ -0,0 +1,60 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveShell(t *testing.T) {
+	dir := t.TempDir()
+	shell := func(name string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tuckShell, configured, userShell := shell("tuck-shell"), shell("configured"), shell("user-shell")
+	notExecutable := filepath.Join(dir, "not-executable")
+	if err := os.WriteFile(notExecutable, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		tuckShell  string
+		configured string
+		shell      string
+		want       string
+		wantErr    string
+	}{
+		{name: "TUCK_SHELL first", tuckShell: tuckShell, configured: configured, shell: userShell, want: tuckShell},
+		{name: "configured before SHELL", configured: configured, shell: userShell, want: configured},
+		{name: "SHELL", shell: userShell, want: userShell},
+		{name: "default", want: "/bin/sh"},
+		{name: "looked up in PATH", shell: "sh", want: "sh"},
+		{name: "missing", tuckShell: filepath.Join(dir, "missing"), shell: userShell, wantErr: "invalid shell"},
+		{name: "not executable", configured: notExecutable, wantErr: "invalid shell"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TUCK_SHELL", tt.tuckShell)
+			t.Setenv("SHELL", tt.shell)
+			got, err := ResolveShell(tt.configured)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ResolveShell() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveShell() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveShell() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
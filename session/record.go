@@ -0,0 +1,80 @@
+package session
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Recording format: a sequence of frames
+// [timestamp:8bytes (unix nanoseconds)][length:4bytes][data:N bytes]
+// A length with frameResize set marks a change of terminal size, with
+// [rows:2bytes][cols:2bytes] as its data. Output is never that long, so
+// recordings from before resizes were recorded read the same.
+const frameResize uint32 = 1 << 31
+
+// Frame is a chunk of PTY output with the time it was produced,
+// or a change of terminal size (Rows and Cols set, no Data)
+type Frame struct {
+	Time time.Time
+	Data []byte
+	Rows uint16
+	Cols uint16
+}
+
+// IsResize reports whether the frame is a change of terminal size
+func (f Frame) IsResize() bool {
+	return f.Rows > 0 && f.Cols > 0
+}
+
+func writeFrame(w io.Writer, t time.Time, data []byte) error {
+	// Write in one call so concurrent readers never see a partial header
+	frame := make([]byte, 12+len(data))
+	binary.BigEndian.PutUint64(frame[0:8], uint64(t.UnixNano()))
+	binary.BigEndian.PutUint32(frame[8:12], uint32(len(data)))
+	copy(frame[12:], data)
+	_, err := w.Write(frame)
+	return err
+}
+
+// writeResizeFrame records the terminal size changing to rows x cols
+func writeResizeFrame(w io.Writer, t time.Time, rows, cols uint16) error {
+	frame := make([]byte, 16)
+	binary.BigEndian.PutUint64(frame[0:8], uint64(t.UnixNano()))
+	binary.BigEndian.PutUint32(frame[8:12], frameResize|4)
+	binary.BigEndian.PutUint16(frame[12:14], rows)
+	binary.BigEndian.PutUint16(frame[14:16], cols)
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadFrame reads the next frame from a recording.
+// It returns io.EOF when there are no more frames.
+func ReadFrame(r io.Reader) (Frame, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Frame{}, err
+	}
+	t := time.Unix(0, int64(binary.BigEndian.Uint64(header[0:8])))
+	length := binary.BigEndian.Uint32(header[8:12])
+	resize := length&frameResize != 0
+	data := make([]byte, length&^frameResize)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Frame{}, err
+	}
+	if resize {
+		if len(data) < 4 {
+			return Frame{}, fmt.Errorf("invalid resize frame")
+		}
+		return Frame{
+			Time: t,
+			Rows: binary.BigEndian.Uint16(data[0:2]),
+			Cols: binary.BigEndian.Uint16(data[2:4]),
+		}, nil
+	}
+	return Frame{Time: t, Data: data}, nil
+}
@@ -0,0 +1,78 @@
+package session
+
+import (
+	"fmt"
+	"os"
+)
+
+// Rename renames a session.
+// A running server is asked to move to the new socket path, since the
+// socket it listens on cannot simply be renamed underneath it.
+func Rename(oldName, newName string) error {
+	if err := ValidateName(newName); err != nil {
+		return err
+	}
+	sess, err := Load(oldName)
+	if err != nil {
+		return fmt.Errorf("session %q does not exist", oldName)
+	}
+	if oldName == newName {
+		return nil
+	}
+	if Exists(newName) || infoExists(newName) {
+		return fmt.Errorf("session %q already exists", newName)
+	}
+
+	// Nobody is listening, so the files can be moved directly
+	if sess.Exited() || !isProcessRunning(sess.PID) {
+		oldPath, err := InfoPath(oldName)
+		if err != nil {
+			return err
+		}
+		newPath, err := InfoPath(newName)
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(oldPath, newPath); err != nil {
+			return fmt.Errorf("failed to rename session info: %w", err)
+		}
+		sess.Name = newName
+		if err := sess.Save(); err != nil {
+			return err
+		}
+		// The error a failed session left goes with it
+		if err := renameErrorFile(oldName, newName); err != nil {
+			return err
+		}
+		removeSocket(oldName)
+		return nil
+	}
+
+	return request(oldName, MsgRename, []byte(newName), "rename")
+}
+
+// renameErrorFile moves a session's error file, if it has one, to the new name
+func renameErrorFile(oldName, newName string) error {
+	oldPath, err := ErrorPath(oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := ErrorPath(newName)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(oldPath, newPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rename error file: %w", err)
+	}
+	return nil
+}
+
+// infoExists checks if a session info file exists (including exited sessions)
+func infoExists(name string) bool {
+	path, err := InfoPath(name)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
@@ -1,11 +1,20 @@
 package session
 
 import (
+	"bytes"
+	"compress/flate"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"maps"
 	"net"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -14,44 +23,352 @@ const (
 	MsgInput  byte = 1
 	MsgOutput byte = 2
 	MsgResize byte = 3
-	MsgExit   byte = 4
+	MsgExit   byte = 4 // Server: [exit code:4] (empty from older servers = 0)
+	MsgRename byte = 5 // Client: new name; server reply: empty on success, error text on failure
+	MsgHello  byte = 6 // First message in both directions: [version:1byte][flags:1byte] then client: [token][0][TERM], server: [TERM]
+	MsgError  byte = 7 // Server: error text, then the connection is closed
+	MsgPing   byte = 8 // Client keepalive, answered with MsgPong
+	MsgPong   byte = 9
+
+	MsgCompressedOutput byte = 10 // Output as a chunk of the connection's flate stream
+	MsgQuery            byte = 11 // Client: empty; server reply: the session's Status as JSON
+	MsgKill             byte = 12 // Client: end the session, as "tuck kill" does
+	MsgTakeover         byte = 13 // Client: detach every other attached client; server to those: detached by a takeover
+	MsgSize             byte = 14 // Server: [rows:2][cols:2] other clients (or a pinned size) hold the PTY to, sent on attach
+	MsgClientCount      byte = 15 // Server: [count:2] attached clients, sent when one attaches or detaches
+	MsgMove             byte = 16 // Client: working directory to record; server reply: empty on success, error text on failure
+)
+
+// Hello flags, sent after the version byte
+const (
+	HelloCompress byte = 1 << 0 // Client wants compressed output
+	HelloCapture  byte = 1 << 1 // Client only wants the replayed output, then the connection is closed
+
+	HelloReplayScreen byte = 1 << 2 // Replay only about a screenful of output
+	HelloReplayNone   byte = 1 << 3 // Don't replay output (neither flag = full replay)
+	HelloAttach       byte = 1 << 4 // Client is an interactive attach (not e.g. send-keys)
+)
+
+// replayChunkSize leaves room for compression overhead within maxMessageSize
+const replayChunkSize = maxMessageSize / 2
+
+// ProtocolVersion is bumped whenever the wire protocol changes incompatibly
+const ProtocolVersion byte = 3
+
+// DefaultBufferSize is the default size of the output replay buffer
+const DefaultBufferSize = 1024 * 1024
+
+// lastActiveInterval is how often LastActive is saved at most when the
+// session produces output or short-lived clients (e.g. "tuck send-keys")
+// connect. Clients attaching or detaching save it right away.
+const lastActiveInterval = 5 * time.Second
+
+// Restart policies
+const (
+	RestartAlways    = "always"     // Run the command again whenever it exits
+	RestartOnFailure = "on-failure" // Run the command again when it exits with a non-zero code
+)
+
+// Restart backoff: the delay doubles after each restart, up to the maximum,
+// and starts over once the command has stayed up for restartResetAfter
+const (
+	restartMinDelay   = time.Second
+	restartMaxDelay   = 30 * time.Second
+	restartResetAfter = 30 * time.Second
 )
 
+// killGrace is how long Kill waits for the command after each signal
+const killGrace = 2 * time.Second
+
+// maxMessageSize is the largest message payload accepted by readMessage
+const maxMessageSize = 1024 * 1024
+
+// clientQueueSize is how many messages may wait for a slow client.
+// A client that falls further behind is disconnected, so that it can't
+// hold up the session's output for everyone else.
+//
+// Reading the command's output never waits on a client: output is queued
+// for each client (see clientInfo.send) and written by its own goroutine.
+// A client that can't keep up is dropped, and one that stops reading is
+// dropped after the write timeout; either way the command keeps running at
+// full speed and the output stays in the replay buffer for the next attach.
+const clientQueueSize = 256
+
+// inputQueueSize is how many input messages may wait for the command to
+// read them before more input is dropped
+const inputQueueSize = 256
+
+// DefaultWriteTimeout is how long a write to a client may take before the
+// client is considered hung and disconnected
+const DefaultWriteTimeout = 5 * time.Second
+
+// clientFlushTimeout is how long shutdown waits for queued messages
+// (such as the exit notification) to reach clients
+const clientFlushTimeout = time.Second
+
 // clientInfo holds per-client state
 type clientInfo struct {
-	rows uint16
-	cols uint16
+	rows  uint16
+	cols  uint16
+	sized bool // Has sent its window size at least once
+
+	attached bool // An interactive attach, as opposed to e.g. send-keys
+
+	writeTimeout time.Duration // Bound on each write; a client that exceeds it is dropped
+
+	// Messages are written by writeLoop in the order they were queued
+	queue   chan clientMsg
+	queueMu sync.Mutex // Guards closed, so nothing is queued after closeQueue
+	closed  bool
+	flushed chan struct{} // Closed once writeLoop has returned
+
+	// Only writeLoop touches the compression stream
+	compressor *flate.Writer // Non-nil if the client negotiated compression
+	compressed bytes.Buffer
+}
+
+type clientMsg struct {
+	msgType byte
+	data    []byte
+}
+
+// send queues a message for the client without blocking.
+// If the queue is full, the client is disconnected instead, and send
+// returns false.
+func (c *clientInfo) send(conn net.Conn, msgType byte, data []byte) bool {
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+	if c.closed {
+		return true
+	}
+	select {
+	case c.queue <- clientMsg{msgType, data}:
+		return true
+	default:
+		_ = conn.Close()
+		return false
+	}
+}
+
+// closeQueue stops the writer once the queued messages have been written
+func (c *clientInfo) closeQueue() {
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.queue)
+	}
+}
+
+// writeLoop writes queued messages to the client until the queue is closed
+func (c *clientInfo) writeLoop(conn net.Conn) {
+	defer close(c.flushed)
+	for msg := range c.queue {
+		// A client that stopped reading would otherwise hold this write
+		// (and the queued messages behind it) forever. The deadline is
+		// cleared afterwards, as replies like MsgPong are written directly.
+		_ = conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+		var err error
+		if msg.msgType == MsgOutput {
+			err = c.writeOutput(conn, msg.data)
+		} else {
+			err = writeMessage(conn, msg.msgType, msg.data)
+		}
+		_ = conn.SetWriteDeadline(time.Time{})
+		if err != nil {
+			// The reader notices the closed connection and cleans up
+			_ = conn.Close()
+			return
+		}
+	}
+}
+
+// writeOutput sends output to the client, compressing it if negotiated
+func (c *clientInfo) writeOutput(conn net.Conn, data []byte) error {
+	if c.compressor == nil {
+		return writeMessage(conn, MsgOutput, data)
+	}
+	// The stream is shared across messages for better ratios; Flush makes
+	// everything written so far decodable by the client
+	c.compressed.Reset()
+	if _, err := c.compressor.Write(data); err != nil {
+		return err
+	}
+	if err := c.compressor.Flush(); err != nil {
+		return err
+	}
+	return writeMessage(conn, MsgCompressedOutput, c.compressed.Bytes())
 }
 
-// Server manages a session
+// Server manages a session.
+// NewServer starts the command and listens for clients; Run (or Create,
+// which does both) serves them until the command exits for good or Kill
+// or Shutdown is called. The session's files are removed on the way out.
 type Server struct {
-	session     *Session
+	session     *Session // Guarded by mu, which also serializes saving it
 	pty         *PTY
 	listener    net.Listener
+	tcpListener net.Listener // Optional TCP listener for remote clients
 	clients     map[net.Conn]*clientInfo
 	mu          sync.RWMutex
 	done        chan struct{}
+	stopped     chan struct{} // Closed once Shutdown has cleaned up
+	ptyDone     chan struct{} // Closed once the command has exited
+	input       chan []byte   // Client input waiting to be written to the PTY
 	ptyExited   bool
+	killed      bool  // Kill is ending the command, so its exit isn't reported
+	ptyErr      error // Why reading the command's output failed, if it did
+	saveFailed  bool  // Saving the session info failed, and that was reported
 	outputBuf   []byte
 	outputBufMu sync.Mutex
+	altScreen   bool // The output has left the terminal on the alternate screen
 	hadClient   bool
+	keepInfo    bool     // Keep session info after shutdown so the exit code can be listed
+	recordFile  *os.File // Receives timestamped output frames if recording is enabled
+	bufferPath  string   // Receives snapshots of outputBuf if persisting it is enabled
+	bufferSave  sync.Mutex
+	bufferSaved time.Time // When outputBuf was last snapshot (guarded by outputBufMu)
+	lastOutput  time.Time
+	idleTimeout time.Duration
+	bufferSize  int
+
+	writeTimeout time.Duration // Given to each client
+
+	logFile io.WriteCloser // Receives PTY output if logging is enabled (raw, or normalized)
+
+	cwd string // Directory the shell last reported with OSC 7 (guarded by mu)
+
+	debug     *slog.Logger  // Records connections, resizes and the command's lifecycle (discards unless enabled)
+	debugFile *rotatingFile // Where debug writes to, if enabled
+
+	// Saving LastActive is throttled (see touch)
+	lastSave    time.Time   // When the session info was last saved
+	activeTimer *time.Timer // Saves LastActive once lastActiveInterval has passed, if pending
+}
+
+// ServerOptions contains options for creating a server
+type ServerOptions struct {
+	LogPath     string        // Append all PTY output to this file (empty = no logging)
+	RecordPath  string        // Append timestamped output frames to this file (empty = no recording)
+	IdleTimeout time.Duration // Shut down after this long without clients or output (0 = never)
+	BufferSize  int           // Output replayed to attaching clients, in bytes (0 = DefaultBufferSize)
+	BufferPath  string        // Keep a snapshot of that output here, and restore it on start (empty = don't)
+	Dir         string        // Working directory for the command (empty = current directory)
+	Env         []string      // Extra KEY=VALUE environment variables for the command
+	Shell       string        // Shell to run when no command is given ($TUCK_SHELL overrides; empty = $SHELL)
+	Term        string        // TERM for the command (empty = inherited, or DefaultTerm)
+	ViaShell    bool          // Run the command through the shell (see PTYOptions.ViaShell)
+	Restart     string        // Restart policy: RestartAlways, RestartOnFailure or empty (never)
+	ListenAddr  string        // Also accept clients over TCP on host:port (empty = Unix socket only)
+	NoAuth      bool          // Accept clients without a token
+	Tags        []string      // Labels stored in the session info
+	Group       string        // Group stored in the session info
+	Rows        uint16        // Initial terminal size, until clients attach (0 = the PTY's default)
+	Cols        uint16
+	PinnedRows  uint16 // Keep the terminal this size whatever size clients have (0 = follow clients)
+	PinnedCols  uint16
+
+	WriteTimeout time.Duration // Drop a client when a write to it takes longer (0 = DefaultWriteTimeout)
+	LogNormalize bool          // Log lines as they end up on screen, with carriage returns and backspaces applied
+	DebugLogPath string        // Write a debug log of what the server does here (empty = don't)
 }
 
 // NewServer creates a new server for a session
-func NewServer(name string, command []string) (*Server, error) {
+func NewServer(name string, command []string, opts ServerOptions) (*Server, error) {
 	// Ensure data directory exists
-	if _, err := EnsureDataDir(); err != nil {
+	if _, err := CheckDataDir(); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+
+	// Claim the name before checking it, so that of two servers started
+	// with the same name at once, only one gets past the check
+	if err := acquireLock(name); err != nil {
 		return nil, err
 	}
+	started := false
+	defer func() {
+		if !started {
+			releaseLock(name)
+		}
+	}()
 
 	// Check if session already exists
 	if Exists(name) {
-		return nil, os.ErrExist
+		return nil, fmt.Errorf("session %q already exists", name)
+	}
+
+	bufferSize := opts.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	writeTimeout := opts.WriteTimeout
+	if writeTimeout <= 0 {
+		writeTimeout = DefaultWriteTimeout
+	}
+
+	// Open output log and recording
+	logFile, err := openAppend(opts.LogPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	recordFile, err := openAppend(opts.RecordPath)
+	if err != nil {
+		_ = logFile.Close()
+		return nil, fmt.Errorf("failed to open recording file: %w", err)
+	}
+	debug, debugFile, err := newDebugLogger(opts.DebugLogPath)
+	if err != nil {
+		_ = logFile.Close()
+		_ = recordFile.Close()
+		return nil, fmt.Errorf("failed to open debug log: %w", err)
+	}
+	closeFiles := func() {
+		// Close on a nil *os.File is a harmless error
+		_ = logFile.Close()
+		_ = recordFile.Close()
+		if debugFile != nil {
+			_ = debugFile.Close()
+		}
+	}
+
+	token := ""
+	if !opts.NoAuth {
+		token, err = generateToken()
+		if err != nil {
+			closeFiles()
+			return nil, err
+		}
 	}
 
 	// Start PTY
-	p, err := StartPTY(name, command)
+	dir := opts.Dir
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	pinnedRows, pinnedCols := min(opts.PinnedRows, maxWinSize), min(opts.PinnedCols, maxWinSize)
+	rows, cols := opts.Rows, opts.Cols
+	if pinnedRows > 0 {
+		rows = pinnedRows
+	}
+	if pinnedCols > 0 {
+		cols = pinnedCols
+	}
+	rows, cols, _ = clampSize(rows, cols)
+	p, err := StartPTY(name, command, PTYOptions{
+		Dir:      dir,
+		Env:      opts.Env,
+		Shell:    opts.Shell,
+		Term:     opts.Term,
+		Rows:     rows,
+		Cols:     cols,
+		ViaShell: opts.ViaShell,
+	})
 	if err != nil {
+		closeFiles()
 		return nil, err
 	}
 
@@ -59,51 +376,278 @@ func NewServer(name string, command []string) (*Server, error) {
 	sockPath, err := SocketPath(name)
 	if err != nil {
 		_ = p.Close()
+		closeFiles()
 		return nil, err
 	}
 
-	listener, err := net.Listen("unix", sockPath)
+	// A crashed server's socket would be in the way
+	if Stale(name) {
+		_ = os.Remove(sockPath)
+	}
+	listener, err := listenUnix(sockPath)
 	if err != nil {
 		_ = p.Close()
+		closeFiles()
 		return nil, err
 	}
 
+	// Optionally listen on TCP as well
+	var tcpListener net.Listener
+	listenAddr := ""
+	if opts.ListenAddr != "" {
+		tcpListener, err = net.Listen("tcp", opts.ListenAddr)
+		if err != nil {
+			_ = listener.Close()
+			_ = os.Remove(sockPath)
+			_ = p.Close()
+			closeFiles()
+			return nil, fmt.Errorf("failed to listen on %s: %w", opts.ListenAddr, err)
+		}
+		listenAddr = tcpListener.Addr().String()
+	}
+	closeListeners := func() {
+		_ = listener.Close()
+		_ = os.Remove(sockPath)
+		if tcpListener != nil {
+			_ = tcpListener.Close()
+		}
+	}
+
 	// Save session info
+	now := time.Now()
 	sess := &Session{
-		Name:       name,
-		PID:        os.Getpid(),
-		Command:    command,
-		LastActive: time.Now(),
+		Name:        name,
+		PID:         os.Getpid(),
+		Command:     command,
+		CreatedAt:   now,
+		LastActive:  now,
+		LogPath:     opts.LogPath,
+		RecordPath:  opts.RecordPath,
+		BufferPath:  opts.BufferPath,
+		IdleTimeout: opts.IdleTimeout,
+		Dir:         dir,
+		ListenAddr:  listenAddr,
+		Token:       token,
+		Tags:        opts.Tags,
+		Group:       opts.Group,
+		Term:        lookupEnv(p.Cmd.Env, "TERM"),
+		Restart:     opts.Restart,
+		Rows:        rows,
+		Cols:        cols,
+		PinnedRows:  pinnedRows,
+		PinnedCols:  pinnedCols,
 	}
 	if err := sess.Save(); err != nil {
-		_ = listener.Close()
+		closeListeners()
 		_ = p.Close()
+		closeFiles()
 		return nil, err
 	}
+	appendEvent(EventCreated, name, nil)
+
+	// The recording starts at the size the command starts with
+	if recordFile != nil && rows > 0 {
+		_ = writeResizeFrame(recordFile, now, rows, cols)
+	}
 
+	var logOut io.WriteCloser
+	if logFile != nil {
+		logOut = logFile
+		if opts.LogNormalize {
+			logOut = newLogNormalizer(logFile)
+		}
+	}
+
+	started = true
 	return &Server{
-		session:  sess,
-		pty:      p,
-		listener: listener,
-		clients:  make(map[net.Conn]*clientInfo),
-		done:     make(chan struct{}),
+		session:     sess,
+		pty:         p,
+		listener:    listener,
+		tcpListener: tcpListener,
+		clients:     make(map[net.Conn]*clientInfo),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		ptyDone:     make(chan struct{}),
+		input:       make(chan []byte, inputQueueSize),
+		recordFile:  recordFile,
+		lastOutput:  time.Now(),
+		idleTimeout: opts.IdleTimeout,
+		bufferSize:  bufferSize,
+		bufferPath:  opts.BufferPath,
+		outputBuf:   restoreBuffer(opts.BufferPath, bufferSize),
+
+		writeTimeout: writeTimeout,
+
+		logFile: logOut,
+
+		debug:     debug,
+		debugFile: debugFile,
 	}, nil
 }
 
-// Run starts the server
+// Create starts a session served from this process, for embedding tuck
+// or testing it without the background server the CLI starts. Clients
+// connect to it by name as usual. Unlike Run, it leaves signals alone;
+// use Kill or Shutdown to end the session and Wait for it to finish.
+func Create(name string, command []string, opts ServerOptions) (*Server, error) {
+	s, err := NewServer(name, command, opts)
+	if err != nil {
+		return nil, err
+	}
+	go func() { _ = s.serve() }()
+	return s, nil
+}
+
+// Wait blocks until the server has shut down and removed its files
+func (s *Server) Wait() {
+	<-s.stopped
+}
+
+// openAppend opens a file for appending, returning nil if path is empty
+func openAppend(path string) (*os.File, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+}
+
+// Run serves the session until it ends. SIGTERM, SIGHUP and SIGINT end
+// the command gracefully, as when the server runs in the background
+// (e.g. "tuck delete" sends SIGTERM); attached clients are told the
+// session ended, with the command's status, before they are disconnected.
 func (s *Server) Run() error {
-	// Handle PTY output in background
-	go s.handlePTYOutput()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGINT)
+	defer signal.Stop(sigCh)
+	go func() {
+		select {
+		case <-sigCh:
+			s.Kill()
+		case <-s.done:
+		}
+	}()
+	return s.serve()
+}
+
+// serve handles the command and clients until the server shuts down
+func (s *Server) serve() error {
+	s.debug.Info("server started", "session", s.session.Name, "pid", s.session.PID,
+		"command", s.session.Command, "cols", s.session.Cols, "rows", s.session.Rows)
+
+	// Handle PTY output in background. Clients may connect before this gets
+	// going (the listener is open since NewServer) without missing any output:
+	// until it is read, output waits in the PTY, and once read it is buffered
+	// and broadcast under outputBufMu, which clients register under, so each
+	// client gets everything since the command started, in its replay or live.
+	outputDone := make(chan struct{})
+	go func() {
+		s.handlePTYOutput(s.pty.file())
+		close(outputDone)
+	}()
+
+	// Write client input to the PTY in the background
+	go s.pumpInput()
+
+	// Shut down when nobody uses the session
+	if s.idleTimeout > 0 {
+		go s.watchIdle()
+	}
+
+	// Accept remote clients
+	if s.tcpListener != nil {
+		go s.acceptTCP()
+	}
+
+	// Snapshot the replay buffer now and then
+	if s.bufferPath != "" {
+		go s.persistBuffer()
+	}
 
 	// Wait for PTY process to exit
 	go func() {
-		_ = s.pty.Wait()
+		delay := restartMinDelay
+		for {
+			started := time.Now()
+			_ = s.pty.Wait()
+			if !s.shouldRestart() {
+				break
+			}
+
+			// Let the output loop drain what the command printed last; a
+			// background process holding the terminal can keep it going
+			select {
+			case <-outputDone:
+			case <-time.After(time.Second):
+			}
+
+			if time.Since(started) >= restartResetAfter {
+				delay = restartMinDelay
+			}
+			s.debug.Info("command exited, restarting", "code", s.pty.ExitCode(), "delay", delay)
+			s.output(fmt.Appendf(nil, "\r\n[%s: 🔄 exited %d, restarting in %s]\r\n", AppName, s.pty.ExitCode(), delay))
+			if !s.sleepUnlessKilled(delay) {
+				break
+			}
+			delay = min(delay*2, restartMaxDelay)
+
+			s.mu.Lock()
+			name := s.session.Name
+			s.mu.Unlock()
+			if err := s.pty.Restart(name); err != nil {
+				s.debug.Error("restart failed", "err", err)
+				s.output(fmt.Appendf(nil, "[%s: ❌ restart failed: %v]\r\n", AppName, err))
+				break
+			}
+			// Clear the screen for the new run; the old output stays in the scrollback
+			s.output([]byte("\x1b[H\x1b[2J"))
+			outputDone = make(chan struct{})
+			go func(f *os.File, done chan struct{}) {
+				s.handlePTYOutput(f)
+				close(done)
+			}(s.pty.file(), outputDone)
+
+			s.mu.Lock()
+			s.session.Restarts++
+			select {
+			case <-s.done:
+			default:
+				s.saveSession()
+			}
+			s.mu.Unlock()
+		}
+
+		// Same for the last run, so clients get all its output before the exit
+		select {
+		case <-outputDone:
+		case <-time.After(time.Second):
+		}
+		close(s.ptyDone)
+		select {
+		case <-s.done:
+			// Killed by Shutdown, nothing to report
+			return
+		default:
+		}
 		s.mu.Lock()
+		if s.killed {
+			// Kill reports the exit and shuts down
+			s.mu.Unlock()
+			return
+		}
+		exitCode := s.pty.ExitCode()
+		s.debug.Info("command exited", "code", exitCode)
 		s.ptyExited = true
+		s.session.ExitCode = &exitCode
+		// Exited sessions are kept for a while from here (see exitedKeep)
+		s.session.LastActive = time.Now()
+		// Leave the exit code behind for `tuck list` if nobody is watching,
+		// and the error, if reading the output failed, in any case
+		s.keepInfo = len(s.clients) == 0 || s.ptyErr != nil
+		s.saveSession()
 		s.mu.Unlock()
 
 		// Notify all clients that PTY exited
-		s.broadcast(MsgExit, nil)
+		s.broadcast(MsgExit, exitPayload(exitCode))
 
 		// Wait briefly for client to connect if none yet
 		for range 50 { // 5 seconds max
@@ -123,10 +667,17 @@ func (s *Server) Run() error {
 
 	// Accept connections
 	for {
-		conn, err := s.listener.Accept()
+		// The listener is swapped when the session is renamed
+		s.mu.RLock()
+		listener := s.listener
+		s.mu.RUnlock()
+
+		conn, err := listener.Accept()
 		if err != nil {
 			select {
 			case <-s.done:
+				// Let Shutdown finish removing session files before the process exits
+				<-s.stopped
 				return nil
 			default:
 				continue
@@ -136,7 +687,95 @@ func (s *Server) Run() error {
 	}
 }
 
-// Shutdown stops the server
+// acceptTCP accepts clients on the TCP listener
+func (s *Server) acceptTCP() {
+	for {
+		conn, err := s.tcpListener.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return
+			default:
+				continue
+			}
+		}
+		go s.handleClient(conn)
+	}
+}
+
+// shouldRestart reports whether the command that just exited should be run
+// again, according to the session's restart policy
+func (s *Server) shouldRestart() bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.killed || s.ptyErr != nil {
+		return false
+	}
+	switch s.session.Restart {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return s.pty.ExitCode() != 0
+	}
+	return false
+}
+
+// sleepUnlessKilled waits for d, returning false early if the session is
+// killed or shut down in the meantime
+func (s *Server) sleepUnlessKilled(d time.Duration) bool {
+	deadline := time.Now().Add(d)
+	for time.Now().Before(deadline) {
+		s.mu.RLock()
+		killed := s.killed
+		s.mu.RUnlock()
+		if killed {
+			return false
+		}
+		select {
+		case <-s.done:
+			return false
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return true
+}
+
+// Kill ends the session's command and shuts the server down
+func (s *Server) Kill() {
+	s.debug.Info("killing the session")
+	s.mu.Lock()
+	s.killed = true
+	s.mu.Unlock()
+
+	if s.endCommand() {
+		s.broadcast(MsgExit, exitPayload(s.pty.ExitCode()))
+	}
+	s.Shutdown()
+}
+
+// endCommand sends the command's process group SIGHUP, as if its terminal
+// was closed, then SIGTERM and finally SIGKILL, waiting killGrace after each.
+// It reports whether the command exited.
+func (s *Server) endCommand() bool {
+	for _, sig := range []syscall.Signal{syscall.SIGHUP, syscall.SIGTERM, syscall.SIGKILL} {
+		s.debug.Debug("signalling the command", "signal", sig.String())
+		s.pty.Signal(sig)
+		select {
+		case <-s.ptyDone:
+			return true
+		case <-time.After(killGrace):
+		}
+	}
+	return false
+}
+
+// Shutdown stops the server. Only the first call does anything, as the
+// command exiting, Kill and a signal may all get here.
 func (s *Server) Shutdown() {
 	select {
 	case <-s.done:
@@ -144,22 +783,163 @@ func (s *Server) Shutdown() {
 	default:
 		close(s.done)
 	}
+	s.debug.Info("shutting down")
 
-	_ = s.listener.Close()
 	_ = s.pty.Close()
+	if s.logFile != nil {
+		_ = s.logFile.Close()
+	}
+	if s.recordFile != nil {
+		_ = s.recordFile.Close()
+	}
 
 	s.mu.Lock()
-	for conn := range s.clients {
-		_ = conn.Close()
+	_ = s.listener.Close()
+	if s.tcpListener != nil {
+		_ = s.tcpListener.Close()
 	}
+	clients := maps.Clone(s.clients)
+	name := s.session.Name
+	keepInfo := s.keepInfo
+	failed := s.ptyErr != nil
+	exitCode := s.session.ExitCode
 	s.mu.Unlock()
 
-	// Clean up session files
-	_ = Remove(s.session.Name)
+	// Let clients receive what is still queued, e.g. the exit notification,
+	// giving them all clientFlushTimeout together
+	for _, info := range clients {
+		info.closeQueue()
+	}
+	deadline := time.Now().Add(clientFlushTimeout)
+	for conn, info := range clients {
+		select {
+		case <-info.flushed:
+		case <-time.After(time.Until(deadline)):
+		}
+		_ = conn.Close()
+	}
+
+	if s.bufferPath != "" {
+		s.saveBuffer()
+	}
+	appendEvent(EventExited, name, exitCode)
+	if s.debugFile != nil {
+		_ = s.debugFile.Close()
+	}
+
+	// Clean up session files, unless the session was deleted, as its
+	// name may have been taken by a new one in the meantime
+	if sess, err := Load(name); err != nil || sess.PID != os.Getpid() {
+		releaseLock(name)
+		close(s.stopped)
+		return
+	}
+	switch {
+	case keepInfo && failed:
+		// Leave the error file with the info
+		if sockPath, err := SocketPath(name); err == nil {
+			_ = os.Remove(sockPath)
+		}
+	case keepInfo:
+		removeSocket(name)
+	default:
+		_ = Remove(name)
+	}
+	// Only now may another server take the name
+	releaseLock(name)
+	close(s.stopped)
+}
+
+// bufferSaveInterval is how often the replay buffer snapshot is updated
+// while there is new output
+const bufferSaveInterval = 5 * time.Second
+
+// persistBuffer keeps the replay buffer snapshot up to date
+func (s *Server) persistBuffer() {
+	ticker := time.NewTicker(bufferSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			// Shutdown saves the final state
+			return
+		case <-ticker.C:
+			s.saveBuffer()
+		}
+	}
+}
+
+// saveBuffer writes the replay buffer to its snapshot if there has been
+// output since the last time. The buffer is already trimmed to bufferSize,
+// so the snapshot is too.
+func (s *Server) saveBuffer() {
+	s.bufferSave.Lock()
+	defer s.bufferSave.Unlock()
+
+	s.outputBufMu.Lock()
+	if !s.lastOutput.After(s.bufferSaved) {
+		s.outputBufMu.Unlock()
+		return
+	}
+	s.bufferSaved = time.Now()
+	buf := bytes.Clone(s.outputBuf)
+	s.outputBufMu.Unlock()
+
+	_ = writeFileAtomic(s.bufferPath, buf)
+}
+
+// restoreBuffer loads a replay buffer snapshot left by an earlier server,
+// trimmed to bufferSize in case that has shrunk since. What the earlier
+// command left on the screen is reset, and a note marks where it ends.
+func restoreBuffer(path string, bufferSize int) []byte {
+	if path == "" {
+		return nil
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil || len(buf) == 0 {
+		return nil
+	}
+	buf = safeTrimStart(buf, bufferSize)
+	if altScreen(buf, false) {
+		buf = append(buf, "\x1b[?1049l"...)
+	}
+	return fmt.Appendf(buf, "\x1b[0m\r\n[%s: 📜 output restored from an earlier run]\r\n", AppName)
+}
+
+// watchIdle shuts the server down once it has had no clients and no output for idleTimeout
+func (s *Server) watchIdle() {
+	interval := min(max(s.idleTimeout/4, time.Second), time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.RLock()
+		attached := len(s.clients) > 0
+		lastActive := s.session.LastActive
+		s.mu.RUnlock()
+		s.outputBufMu.Lock()
+		lastOutput := s.lastOutput
+		s.outputBufMu.Unlock()
+
+		if attached {
+			continue
+		}
+		if time.Since(lastActive) >= s.idleTimeout && time.Since(lastOutput) >= s.idleTimeout {
+			s.Shutdown()
+			return
+		}
+	}
 }
 
 // handlePTYOutput reads from PTY and broadcasts to all clients
-func (s *Server) handlePTYOutput() {
+// The PTY master is passed in, since a restart replaces it.
+func (s *Server) handlePTYOutput(f *os.File) {
 	buf := make([]byte, 32*1024)
 	for {
 		select {
@@ -168,66 +948,255 @@ func (s *Server) handlePTYOutput() {
 		default:
 		}
 
-		n, err := s.pty.File.Read(buf)
+		n, err := f.Read(buf)
 		if err != nil {
+			if !ptyClosed(err) {
+				s.failPTY(err)
+			}
 			return
 		}
 		if n > 0 {
-			// Buffer output for late-connecting clients
-			s.outputBufMu.Lock()
-			s.outputBuf = append(s.outputBuf, buf[:n]...)
-			// Limit buffer size to 1MB
-			if len(s.outputBuf) > 1024*1024 {
-				s.outputBuf = s.outputBuf[len(s.outputBuf)-1024*1024:]
-			}
-			s.outputBufMu.Unlock()
+			s.output(buf[:n])
+		}
+	}
+}
+
+// ptyClosed reports whether a PTY read error just means there is no more
+// output: EOF, EIO once the command's side of the terminal is closed (as on
+// Linux when the command exits), or the PTY closed by Shutdown or Restart
+func ptyClosed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.EIO) || errors.Is(err, os.ErrClosed)
+}
+
+// failPTY handles an unexpected error reading the command's output. Its
+// output can't be shown any more, so the command is ended, and the error is
+// left in the session's error file, which outlives the session, so it
+// doesn't just vanish from "tuck list" without a trace.
+func (s *Server) failPTY(err error) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	err = fmt.Errorf("failed to read output: %w", err)
+	s.debug.Error("reading the command's output failed", "err", err)
+
+	s.mu.Lock()
+	s.ptyErr = err
+	name := s.session.Name
+	s.mu.Unlock()
+	if errPath, pathErr := ErrorPath(name); pathErr == nil {
+		_ = os.WriteFile(errPath, []byte(err.Error()), 0600)
+	}
+
+	s.output(fmt.Appendf(nil, "\r\n[%s: ❌ %v, ending the session]\r\n", AppName, err))
+	if !s.endCommand() {
+		s.Shutdown()
+	}
+}
 
-			s.broadcast(MsgOutput, buf[:n])
+// queueInput hands client input to pumpInput without waiting for the PTY.
+// If the command has stopped reading (e.g. it is paused with Ctrl+S) and the
+// queue is full, the input is dropped, so clients can still ping, resize
+// and detach instead of hanging on a large paste.
+func (s *Server) queueInput(data []byte) {
+	select {
+	case s.input <- data:
+	default:
+	}
+}
+
+// pumpInput writes queued client input to the PTY in order.
+// Flow control characters are passed through like any other input; the
+// terminal handles Ctrl+S and Ctrl+Q itself.
+func (s *Server) pumpInput() {
+	for {
+		select {
+		case data := <-s.input:
+			_, _ = s.pty.Write(data)
+		case <-s.done:
+			return
 		}
 	}
 }
 
+// output logs, buffers and broadcasts session output
+func (s *Server) output(data []byte) {
+	if s.logFile != nil {
+		_, _ = s.logFile.Write(data)
+	}
+	if s.recordFile != nil {
+		_ = writeFrame(s.recordFile, time.Now(), data)
+	}
+
+	// Clients are written to later, and the caller reuses data
+	data = bytes.Clone(data)
+
+	// Buffer output for late-connecting clients
+	s.outputBufMu.Lock()
+	s.lastOutput = time.Now()
+	s.outputBuf = append(s.outputBuf, data...)
+	// Include the end of earlier output, in case a switch was split between reads
+	tail := s.outputBuf[max(0, len(s.outputBuf)-len(data)-maxAltScreenSeq+1):]
+	s.altScreen = altScreen(tail, s.altScreen)
+	// Limit buffer size
+	s.outputBuf = safeTrimStart(s.outputBuf, s.bufferSize)
+	// Queued while the buffer is locked, so that a client attaching now
+	// gets this either in its replay or live, never both
+	s.broadcast(MsgOutput, data)
+	s.outputBufMu.Unlock()
+
+	// A busy session counts as active even with nobody attached
+	s.mu.Lock()
+	if dir := reportedDir(data); dir != "" {
+		s.cwd = dir
+	}
+	s.touch(false)
+	s.mu.Unlock()
+}
+
 // handleClient handles a single client connection
 func (s *Server) handleClient(conn net.Conn) {
+	flags, clientTerm, err := s.handshake(conn)
+	if err != nil {
+		s.debug.Warn("handshake failed", "err", err)
+		_ = writeMessage(conn, MsgError, []byte(err.Error()))
+		_ = conn.Close()
+		return
+	}
+
+	// A capture isn't a client; it only takes a copy of the output
+	if flags&HelloCapture != 0 {
+		s.debug.Debug("output captured")
+		// Copied, so a slow reader doesn't hold up the session's output
+		s.outputBufMu.Lock()
+		out := bytes.Clone(s.outputBuf)
+		s.outputBufMu.Unlock()
+		for buf := out; len(buf) > 0; {
+			n := min(len(buf), replayChunkSize)
+			_ = conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+			if err := writeMessage(conn, MsgOutput, buf[:n]); err != nil {
+				break
+			}
+			buf = buf[n:]
+		}
+		_ = conn.Close()
+		return
+	}
+
+	info := &clientInfo{
+		flushed:      make(chan struct{}),
+		attached:     flags&HelloAttach != 0,
+		writeTimeout: s.writeTimeout,
+	}
+	if flags&HelloCompress != 0 {
+		info.compressor, _ = flate.NewWriter(&info.compressed, flate.BestSpeed)
+	}
+
+	// Size of the screen, for a screenful replay
+	s.mu.RLock()
+	rows, cols := int(s.session.Rows), int(s.session.Cols)
+	shared := s.session.PinnedRows > 0 && s.session.PinnedCols > 0
+	for _, other := range s.clients {
+		if other.rows > 0 && other.cols > 0 {
+			shared = true
+		}
+	}
+	s.mu.RUnlock()
+	if rows == 0 || cols == 0 {
+		rows, cols = 24, 80
+	}
+
+	// Queue buffered output for the new client. It is registered for live
+	// output before the buffer is unlocked, so nothing is missed or repeated.
+	s.outputBufMu.Lock()
+	replay := s.outputBuf
+	switch {
+	case flags&HelloReplayNone != 0:
+		replay = nil
+	case flags&HelloReplayScreen != 0:
+		replay = lastScreen(replay, rows, cols)
+		if s.altScreen && !altScreen(replay, false) {
+			// The switch to the alternate screen was cut off
+			replay = append([]byte("\x1b[?1049h"), replay...)
+		}
+	}
+	// (chunked, since the buffer may be larger than a single message;
+	// the queue has room for all of it on top of the live output)
+	replay = bytes.Clone(replay)
+	info.queue = make(chan clientMsg, clientQueueSize+len(replay)/replayChunkSize+1)
+	// The PTY is sized for the smallest client (or pinned), so tell an
+	// attaching client how big it can get while the others are attached
+	if shared && info.attached {
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint16(size[0:2], uint16(rows))
+		binary.BigEndian.PutUint16(size[2:4], uint16(cols))
+		info.send(conn, MsgSize, size)
+	}
+	for buf := replay; len(buf) > 0; {
+		n := min(len(buf), replayChunkSize)
+		info.send(conn, MsgOutput, buf[:n])
+		buf = buf[n:]
+	}
+	go info.writeLoop(conn)
+
 	s.mu.Lock()
-	s.clients[conn] = &clientInfo{}
+	s.clients[conn] = info
+	s.debug.Info("client connected", "attach", flags&HelloAttach != 0, "term", clientTerm, "clients", len(s.clients))
 	s.hadClient = true
+	if flags&HelloAttach != 0 {
+		s.session.ClientTerm = clientTerm
+		s.notifyClientCount()
+	}
 	// Update last active time
-	s.session.LastActive = time.Now()
-	_ = s.session.Save()
+	s.touch(flags&HelloAttach != 0)
+	name := s.session.Name
 	s.mu.Unlock()
+	s.outputBufMu.Unlock()
 
-	// Send buffered output to new client
-	s.outputBufMu.Lock()
-	if len(s.outputBuf) > 0 {
-		_ = writeMessage(conn, MsgOutput, s.outputBuf)
+	attached := flags&HelloAttach != 0
+	if attached {
+		appendEvent(EventAttached, name, nil)
 	}
-	s.outputBufMu.Unlock()
 
 	// If PTY already exited, send exit message and close
 	s.mu.RLock()
 	ptyExited := s.ptyExited
+	exitCode := s.session.ExitCode
 	s.mu.RUnlock()
 	if ptyExited {
-		_ = writeMessage(conn, MsgExit, nil)
-		_ = conn.Close()
 		s.mu.Lock()
 		delete(s.clients, conn)
+		s.keepInfo = false // The client has seen the exit
+		name := s.session.Name
 		s.mu.Unlock()
+		info.send(conn, MsgExit, exitPayload(*exitCode))
+		info.closeQueue()
+		select {
+		case <-info.flushed:
+		case <-time.After(clientFlushTimeout):
+		}
+		_ = conn.Close()
+		if attached {
+			appendEvent(EventDetached, name, nil)
+		}
 		return
 	}
 
 	defer func() {
 		s.mu.Lock()
 		delete(s.clients, conn)
-		// Resize PTY to a remaining client's size if any
-		for _, info := range s.clients {
-			if info != nil && info.rows > 0 && info.cols > 0 {
-				_ = s.pty.Resize(info.rows, info.cols)
-				break
-			}
+		s.debug.Info("client disconnected", "attach", attached, "clients", len(s.clients))
+		if attached {
+			appendEvent(EventDetached, s.session.Name, nil)
+			s.notifyClientCount()
 		}
+		// Idle time counts from when the last client left
+		s.touch(attached)
+		// The departed client may have been the smallest one
+		s.resizeToSmallest()
 		s.mu.Unlock()
+		info.closeQueue()
 		_ = conn.Close()
 	}()
 
@@ -246,59 +1215,427 @@ func (s *Server) handleClient(conn net.Conn) {
 
 		switch msgType {
 		case MsgInput:
-			// Resize PTY to active client's size on input
-			s.mu.RLock()
-			if info := s.clients[conn]; info != nil && info.rows > 0 && info.cols > 0 {
-				_ = s.pty.Resize(info.rows, info.cols)
-			}
-			s.mu.RUnlock()
-			_, _ = s.pty.File.Write(data)
+			s.queueInput(data)
 		case MsgResize:
-			if len(data) >= 4 {
-				rows := binary.BigEndian.Uint16(data[0:2])
-				cols := binary.BigEndian.Uint16(data[2:4])
+			// Ignore truncated messages, and sizes a terminal can't have
+			// (e.g. 0 rows while the emulator is changing its font)
+			if len(data) < 4 {
+				continue
+			}
+			rows, cols, ok := clampSize(binary.BigEndian.Uint16(data[0:2]), binary.BigEndian.Uint16(data[2:4]))
+			if ok {
 				// Store client's window size
 				s.mu.Lock()
+				firstSize := false
 				if info := s.clients[conn]; info != nil {
 					info.rows = rows
 					info.cols = cols
+					firstSize = !info.sized
+					info.sized = true
 				}
+				s.debug.Debug("client resized", "cols", cols, "rows", rows)
+				s.resizeToSmallest()
 				s.mu.Unlock()
-				_ = s.pty.Resize(rows, cols)
+
+				// The replay doesn't restore a full-screen program's screen,
+				// so ask it to repaint for the client that just attached
+				if firstSize {
+					s.outputBufMu.Lock()
+					alt := s.altScreen
+					s.outputBufMu.Unlock()
+					if alt {
+						s.pty.Signal(syscall.SIGWINCH)
+					}
+				}
+			}
+		case MsgPing:
+			_ = writeMessage(conn, MsgPong, nil)
+		case MsgRename:
+			var reply []byte
+			if err := s.rename(string(data)); err != nil {
+				reply = []byte(err.Error())
 			}
+			_ = writeMessage(conn, MsgRename, reply)
+		case MsgMove:
+			var reply []byte
+			if err := s.move(string(data)); err != nil {
+				reply = []byte(err.Error())
+			}
+			_ = writeMessage(conn, MsgMove, reply)
+		case MsgQuery:
+			data, _ := json.Marshal(s.status())
+			_ = writeMessage(conn, MsgQuery, data)
+		case MsgKill:
+			// Kill waits for the command to exit, and shuts down in the end
+			s.debug.Info("kill requested by a client")
+			go s.Kill()
+		case MsgTakeover:
+			s.takeover(conn)
 		}
 	}
 }
 
-// broadcast sends a message to all connected clients
-func (s *Server) broadcast(msgType byte, data []byte) {
+// takeover detaches every attached client but conn, like tmux's attach -d.
+// They are told why, so they restore their terminals, and their connections
+// are closed once that is sent. They are dropped from the clients right
+// away: they get no more output, and a resize still on its way from one of
+// them can't shrink the PTY back from the new client's size.
+func (s *Server) takeover(conn net.Conn) {
+	s.mu.Lock()
+	evicted := make(map[net.Conn]*clientInfo)
+	for c, info := range s.clients {
+		if c != conn && info.attached {
+			evicted[c] = info
+			delete(s.clients, c)
+		}
+	}
+	s.debug.Info("takeover", "detached", len(evicted))
+	s.resizeToSmallest()
+	s.notifyClientCount()
+	s.mu.Unlock()
+
+	for c, info := range evicted {
+		info.send(c, MsgTakeover, nil)
+		info.closeQueue()
+		go func() {
+			select {
+			case <-info.flushed:
+			case <-time.After(clientFlushTimeout):
+			}
+			_ = c.Close()
+		}()
+	}
+}
+
+// exitPayload encodes an exit code for MsgExit
+func exitPayload(code int) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(int32(code)))
+}
+
+// parseExitPayload decodes a MsgExit payload. Older servers send none.
+func parseExitPayload(data []byte) int {
+	switch len(data) {
+	case 0:
+		return 0
+	case 1:
+		return int(data[0])
+	}
+	if len(data) < 4 {
+		return 0
+	}
+	return int(int32(binary.BigEndian.Uint32(data)))
+}
+
+// Clients returns how many clients are attached to the session
+func (s *Server) Clients() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.attachedClients()
+}
 
-	for conn := range s.clients {
-		_ = writeMessage(conn, msgType, data)
+// attachedClients counts the interactive clients, leaving out e.g.
+// send-keys. s.mu must be held.
+func (s *Server) attachedClients() int {
+	n := 0
+	for _, info := range s.clients {
+		if info.attached {
+			n++
+		}
 	}
+	return n
 }
 
-// Protocol helpers
+// notifyClientCount tells the attached clients how many of them there are
+// now, so people sharing a session see others come and go.
+// s.mu must be held.
+func (s *Server) notifyClientCount() {
+	count := binary.BigEndian.AppendUint16(nil, uint16(s.attachedClients()))
+	for conn, info := range s.clients {
+		if info.attached {
+			info.send(conn, MsgClientCount, count)
+		}
+	}
+}
 
-// Message format: [type:1byte][length:4bytes][data:N bytes]
+// status reports the session's current state for MsgQuery
+func (s *Server) status() *Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cwd := s.cwd
+	if cwd == "" {
+		cwd = s.session.Dir
+	}
+	return &Status{
+		Name:       s.session.Name,
+		PID:        s.session.PID,
+		Clients:    s.attachedClients(),
+		Rows:       s.session.Rows,
+		Cols:       s.session.Cols,
+		CreatedAt:  s.session.CreatedAt,
+		LastActive: s.session.LastActive,
+		Cwd:        cwd,
+	}
+}
 
-func writeMessage(w io.Writer, msgType byte, data []byte) error {
-	header := make([]byte, 5)
-	header[0] = msgType
-	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
-	if _, err := w.Write(header); err != nil {
-		return err
+// maxWinSize bounds the rows and columns a client can set
+const maxWinSize = 1000
+
+// clampSize limits a client's window size to maxWinSize.
+// It returns false for a zero size, which should be ignored.
+func clampSize(rows, cols uint16) (uint16, uint16, bool) {
+	if rows == 0 || cols == 0 {
+		return 0, 0, false
 	}
-	if len(data) > 0 {
-		if _, err := w.Write(data); err != nil {
-			return err
+	return min(rows, maxWinSize), min(cols, maxWinSize), true
+}
+
+// resizeToSmallest resizes the PTY to fit every attached client, like tmux
+// does for a window shared by several clients. A pinned size wins over the
+// clients'. s.mu must be held for writing.
+func (s *Server) resizeToSmallest() {
+	var rows, cols uint16
+	for _, info := range s.clients {
+		// Clients that never sent a size (e.g., read-only) don't count
+		if info.rows == 0 || info.cols == 0 {
+			continue
+		}
+		if rows == 0 || info.rows < rows {
+			rows = info.rows
 		}
+		if cols == 0 || info.cols < cols {
+			cols = info.cols
+		}
+	}
+	if s.session.PinnedRows > 0 {
+		rows = s.session.PinnedRows
+	}
+	if s.session.PinnedCols > 0 {
+		cols = s.session.PinnedCols
+	}
+	if rows == 0 || cols == 0 {
+		return
+	}
+	if rows == s.session.Rows && cols == s.session.Cols {
+		return
+	}
+
+	s.debug.Info("resized", "cols", cols, "rows", rows)
+	_ = s.pty.Resize(rows, cols)
+	if s.recordFile != nil {
+		_ = writeResizeFrame(s.recordFile, time.Now(), rows, cols)
+	}
+
+	// Remember the size for recordings export
+	s.session.Rows = rows
+	s.session.Cols = cols
+	select {
+	case <-s.done:
+	default:
+		s.saveSession()
+	}
+}
+
+// handshake checks the client's protocol version before anything else is sent.
+// It returns the hello flags accepted for this connection and the client's TERM.
+func (s *Server) handshake(conn net.Conn) (byte, string, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer func() { _ = conn.SetReadDeadline(time.Time{}) }()
+
+	msgType, data, err := readMessage(conn)
+	if err != nil {
+		return 0, "", fmt.Errorf("handshake failed: %w", err)
+	}
+	if msgType != MsgHello || len(data) < 1 {
+		return 0, "", fmt.Errorf("handshake failed: expected hello")
+	}
+	if data[0] != ProtocolVersion {
+		return 0, "", fmt.Errorf("protocol version mismatch (session: %d, client: %d); "+
+			"attach with the tuck version that created the session", ProtocolVersion, data[0])
+	}
+	var flags byte
+	if len(data) >= 2 {
+		flags = data[1] & (HelloCompress | HelloCapture | HelloReplayScreen | HelloReplayNone | HelloAttach)
+	}
+	var token, term []byte
+	if len(data) > 2 {
+		token, term, _ = bytes.Cut(data[2:], []byte{0})
+	}
+	if s.session.Token != "" && !checkToken(s.session.Token, string(token)) {
+		return 0, "", fmt.Errorf("authentication failed (missing or wrong token)")
+	}
+	reply := append([]byte{ProtocolVersion, flags}, s.session.Term...)
+	return flags, string(term), writeMessage(conn, MsgHello, reply)
+}
+
+// rename moves the session to a new name and re-listens on the new socket path
+func (s *Server) rename(newName string) error {
+	if err := ValidateName(newName); err != nil {
+		return err
+	}
+	if err := acquireLock(newName); err != nil {
+		return err
+	}
+	if Exists(newName) {
+		releaseLock(newName)
+		return fmt.Errorf("session %q already exists", newName)
+	}
+
+	sockPath, err := SocketPath(newName)
+	if err != nil {
+		releaseLock(newName)
+		return err
+	}
+	listener, err := listenUnix(sockPath)
+	if err != nil {
+		releaseLock(newName)
+		return fmt.Errorf("failed to listen on new socket: %w", err)
 	}
+
+	s.mu.Lock()
+	oldName := s.session.Name
+	oldListener := s.listener
+	s.session.Name = newName
+	if err := s.session.Save(); err != nil {
+		s.session.Name = oldName
+		s.mu.Unlock()
+		_ = listener.Close()
+		_ = os.Remove(sockPath)
+		releaseLock(newName)
+		return err
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	s.debug.Info("renamed", "from", oldName, "to", newName)
+	// Closing the old listener wakes up Accept, which then picks up the new one
+	_ = oldListener.Close()
+	_ = renameErrorFile(oldName, newName)
+	_ = Remove(oldName)
+	releaseLock(oldName)
 	return nil
 }
 
+// move changes the working directory recorded for the session.
+// The command isn't affected. It overrides the directory the shell last
+// reported, until the shell reports another.
+func (s *Server) move(dir string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oldDir := s.session.Dir
+	s.session.Dir = dir
+	if err := s.session.Save(); err != nil {
+		s.session.Dir = oldDir
+		return err
+	}
+	s.cwd = ""
+	return nil
+}
+
+// touch sets LastActive to now. It is saved right away if saveNow is set (e.g.
+// when a client attaches), and otherwise at most once per
+// lastActiveInterval, so a chatty session doesn't keep writing its info.
+// s.mu must be held for writing.
+func (s *Server) touch(saveNow bool) {
+	s.session.LastActive = time.Now()
+	select {
+	case <-s.done:
+		// Session files are already gone
+		return
+	default:
+	}
+	wait := lastActiveInterval - time.Since(s.lastSave)
+	if saveNow || wait <= 0 {
+		s.saveSession()
+		return
+	}
+	if s.activeTimer == nil {
+		s.activeTimer = time.AfterFunc(wait, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.activeTimer = nil
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			// Unless something else has saved it since
+			if s.session.LastActive.After(s.lastSave) {
+				s.saveSession()
+			}
+		})
+	}
+}
+
+// saveSession saves the session info. A failure (e.g. on a full disk) is
+// written to the error file and shown to clients, once until saving works
+// again, rather than leaving the info silently out of date.
+// s.mu must be held for writing.
+func (s *Server) saveSession() {
+	s.lastSave = time.Now()
+	err := s.session.Save()
+	errPath, pathErr := ErrorPath(s.session.Name)
+	if err == nil {
+		if s.saveFailed {
+			s.saveFailed = false
+			if pathErr == nil && s.ptyErr == nil {
+				_ = os.Remove(errPath)
+			}
+		}
+		return
+	}
+	if s.saveFailed {
+		return
+	}
+	s.saveFailed = true
+	s.debug.Warn("saving the session info failed", "err", err)
+	if pathErr == nil {
+		_ = os.WriteFile(errPath, []byte(err.Error()), 0600)
+	}
+	// Not buffered: it's about the session, not its output.
+	// broadcast takes s.mu, which the caller holds.
+	go s.broadcast(MsgOutput, fmt.Appendf(nil, "\r\n[%s: ⚠️ %v]\r\n", AppName, err))
+}
+
+// broadcast queues a message for all connected clients without waiting
+// for any of them
+func (s *Server) broadcast(msgType byte, data []byte) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for conn, info := range s.clients {
+		if !info.send(conn, msgType, data) {
+			s.debug.Warn("client dropped for falling behind")
+		}
+	}
+}
+
+// listenUnix listens on a session socket. Closing the listener leaves the
+// socket file alone: by the time a server shuts down, the session may have
+// been deleted and the name taken by a new server, whose socket is at the
+// same path. The server removes its socket itself once it has checked.
+func listenUnix(path string) (net.Listener, error) {
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	listener.SetUnlinkOnClose(false)
+	return listener, nil
+}
+
+// Protocol helpers
+
+// Message format: [type:1byte][length:4bytes][data:N bytes]
+
+func writeMessage(w io.Writer, msgType byte, data []byte) error {
+	// A single Write keeps messages from different goroutines from interleaving
+	msg := make([]byte, 5+len(data))
+	msg[0] = msgType
+	binary.BigEndian.PutUint32(msg[1:5], uint32(len(data)))
+	copy(msg[5:], data)
+	_, err := w.Write(msg)
+	return err
+}
+
 func readMessage(r io.Reader) (byte, []byte, error) {
 	header := make([]byte, 5)
 	if _, err := io.ReadFull(r, header); err != nil {
@@ -306,7 +1643,7 @@ func readMessage(r io.Reader) (byte, []byte, error) {
 	}
 	msgType := header[0]
 	length := binary.BigEndian.Uint32(header[1:])
-	if length > 1024*1024 { // 1MB max
+	if length > maxMessageSize {
 		return 0, nil, io.ErrShortBuffer
 	}
 	data := make([]byte, length)
@@ -0,0 +1,279 @@
+package session
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// startServer serves a session from the test process, in a data directory
+// of the test's own, and shuts it down when the test ends
+func startServer(t *testing.T, name string, command []string, opts ServerOptions) *Server {
+	t.Helper()
+	s, err := Create(name, command, opts)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	t.Cleanup(func() {
+		stopped := make(chan struct{})
+		go func() {
+			s.Shutdown()
+			s.Wait()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(10 * time.Second):
+			// Left running, so the test can report why
+			t.Errorf("server %q didn't shut down", name)
+		}
+	})
+	return s
+}
+
+// dialServer connects to a session and performs the handshake with flags
+func dialServer(t *testing.T, name string, flags byte) net.Conn {
+	t.Helper()
+	conn, token, err := dialSession(name, "", 0)
+	if err != nil {
+		t.Fatalf("dialSession() error = %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	if _, _, err := handshake(conn, flags, token); err != nil {
+		t.Fatalf("handshake() error = %v", err)
+	}
+	return conn
+}
+
+// readOutput reads messages until the output received contains want, and
+// returns the output. It fails the test if that doesn't happen in time.
+func readOutput(t *testing.T, conn net.Conn, want string) []byte {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer func() { _ = conn.SetReadDeadline(time.Time{}) }()
+	var out []byte
+	for !bytes.Contains(out, []byte(want)) {
+		msgType, data, err := readMessage(conn)
+		if err != nil {
+			t.Fatalf("waiting for %q in %q: %v", want, out, err)
+		}
+		if msgType == MsgOutput {
+			out = append(out, data...)
+		}
+	}
+	return out
+}
+
+// readExit reads messages until MsgExit and returns the exit code
+func readExit(t *testing.T, conn net.Conn) int {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		msgType, data, err := readMessage(conn)
+		if err != nil {
+			t.Fatalf("waiting for the exit: %v", err)
+		}
+		if msgType == MsgExit {
+			return parseExitPayload(data)
+		}
+	}
+}
+
+func TestServerEndToEnd(t *testing.T) {
+	t.Setenv("TUCK_DATA_DIR", t.TempDir())
+	s := startServer(t, "e2e", []string{"sh", "-c", `read line; echo "got $line"; exit 3`}, ServerOptions{Rows: 24, Cols: 80})
+
+	conn := dialServer(t, "e2e", HelloAttach)
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint16(size[0:2], 30)
+	binary.BigEndian.PutUint16(size[2:4], 100)
+	if err := writeMessage(conn, MsgResize, size); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeMessage(conn, MsgInput, []byte("hello\r")); err != nil {
+		t.Fatal(err)
+	}
+	readOutput(t, conn, "got hello")
+	if code := readExit(t, conn); code != 3 {
+		t.Errorf("exit code = %d, want 3", code)
+	}
+
+	s.Wait()
+	if Exists("e2e") || infoExists("e2e") {
+		t.Error("session files left behind after it ended with a client attached")
+	}
+}
+
+func TestServerKill(t *testing.T) {
+	t.Setenv("TUCK_DATA_DIR", t.TempDir())
+	s := startServer(t, "victim", []string{"sleep", "60"}, ServerOptions{})
+	if !Exists("victim") {
+		t.Fatal("session doesn't exist after Create")
+	}
+	conn := dialServer(t, "victim", HelloAttach)
+
+	go s.Kill()
+	// sleep ends on SIGHUP, the first signal Kill sends
+	if code := readExit(t, conn); code != 128+1 {
+		t.Errorf("exit code = %d, want %d (SIGHUP)", code, 128+1)
+	}
+	s.Wait()
+	if Exists("victim") {
+		t.Error("session still exists after Kill")
+	}
+}
+
+func TestServerEarlyClientGetsFirstOutput(t *testing.T) {
+	t.Setenv("TUCK_DATA_DIR", t.TempDir())
+	// Attaching right after Create races the command's first output, which
+	// must show up in the replay or live either way
+	for i := range 20 {
+		name := fmt.Sprintf("early%d", i)
+		startServer(t, name, []string{"sh", "-c", "echo hi; sleep 5"}, ServerOptions{})
+		conn := dialServer(t, name, HelloAttach)
+		readOutput(t, conn, "hi")
+	}
+}
+
+func TestServerMoveOverridesReportedDir(t *testing.T) {
+	t.Setenv("TUCK_DATA_DIR", t.TempDir())
+	s := startServer(t, "mover", []string{"sh", "-c", `printf '\033]7;file://host/from/shell\a'; sleep 60`}, ServerOptions{})
+	conn := dialServer(t, "mover", HelloAttach)
+	readOutput(t, conn, "/from/shell")
+	// The output is broadcast before the directory is picked up from it
+	deadline := time.Now().Add(5 * time.Second)
+	for s.status().Cwd != "/from/shell" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Cwd = %q, want the directory the shell reported", s.status().Cwd)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := s.move("/moved"); err != nil {
+		t.Fatalf("move() error = %v", err)
+	}
+	if got := s.status().Cwd; got != "/moved" {
+		t.Errorf("Cwd after move = %q, want %q", got, "/moved")
+	}
+}
+
+func TestServerStalledClientDoesNotBlockOutput(t *testing.T) {
+	if testing.Short() {
+		t.Skip("pumps 100MB through the PTY")
+	}
+	t.Setenv("TUCK_DATA_DIR", t.TempDir())
+	// A write timeout longer than the test, so only a full queue can
+	// drop the client. The command can only finish if its output is read.
+	s := startServer(t, "flood", []string{"head", "-c", "100000000", "/dev/zero"}, ServerOptions{WriteTimeout: time.Hour})
+	// Attached, but never reads
+	dialServer(t, "flood", HelloAttach)
+
+	const maxGap = 2 * time.Second
+	timeout := time.After(2 * time.Minute)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-s.ptyDone:
+			s.mu.RLock()
+			clients := len(s.clients)
+			s.mu.RUnlock()
+			if clients != 0 {
+				t.Errorf("%d clients still attached, want the stalled one dropped", clients)
+			}
+			return
+		case <-timeout:
+			t.Fatal("the command didn't get to write all its output")
+		case <-ticker.C:
+		}
+		// A reader blocked on a client would hold the lock
+		if s.outputBufMu.TryLock() {
+			if s.lastOutput.After(last) {
+				last = s.lastOutput
+			}
+			s.outputBufMu.Unlock()
+		}
+		if time.Since(last) > maxGap {
+			t.Fatalf("no output read from the PTY for %v", time.Since(last).Round(time.Millisecond))
+		}
+	}
+}
+
+func TestServerShutdownKeepsNewSessionSocket(t *testing.T) {
+	t.Setenv("TUCK_DATA_DIR", t.TempDir())
+	s := startServer(t, "reused", []string{"sleep", "60"}, ServerOptions{})
+
+	// "tuck delete" removes the files before the old server has shut down,
+	// and a new server takes the name
+	if err := Remove("reused"); err != nil {
+		t.Fatal(err)
+	}
+	sockPath, err := SocketPath("reused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := listenUnix(sockPath)
+	if err != nil {
+		t.Fatalf("listening for the new server: %v", err)
+	}
+	defer func() { _ = listener.Close() }()
+	if err := (&Session{Name: "reused", PID: os.Getppid()}).Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Shutdown()
+	s.Wait()
+	if _, err := os.Stat(sockPath); err != nil {
+		t.Errorf("new server's socket removed by the old one: %v", err)
+	}
+	if sess, err := Load("reused"); err != nil || sess.PID != os.Getppid() {
+		t.Errorf("new server's info = %+v, %v, want it kept", sess, err)
+	}
+}
+
+func TestServerShutdownBoundsClientFlush(t *testing.T) {
+	t.Setenv("TUCK_DATA_DIR", t.TempDir())
+	// More output than the sockets hold, but not enough to fill the
+	// queues and get the clients dropped
+	const size = 600000
+	s := startServer(t, "stuck", []string{"sh", "-c", fmt.Sprintf("sleep 0.3; head -c %d /dev/zero; exec sleep 60", size)}, ServerOptions{WriteTimeout: time.Hour})
+	// Attached, but never read
+	dialServer(t, "stuck", HelloAttach)
+	dialServer(t, "stuck", HelloAttach)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		s.outputBufMu.Lock()
+		n := len(s.outputBuf)
+		s.outputBufMu.Unlock()
+		if n >= size {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d bytes of output, want %d", n, size)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.mu.RLock()
+	clients := len(s.clients)
+	s.mu.RUnlock()
+	if clients != 2 {
+		t.Fatalf("%d clients attached, want both stalled ones", clients)
+	}
+
+	shutDown := make(chan struct{})
+	go func() {
+		s.Shutdown()
+		close(shutDown)
+	}()
+	select {
+	case <-shutDown:
+	case <-time.After(clientFlushTimeout + time.Second):
+		t.Fatalf("Shutdown took longer than %v with two stalled clients", clientFlushTimeout+time.Second)
+	}
+}
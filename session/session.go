@@ -2,23 +2,93 @@ package session
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
+	"unicode"
 )
 
 // Session represents a tuck session
 type Session struct {
-	Name       string    `json:"name"`
-	PID        int       `json:"pid"`
-	Command    []string  `json:"command"`
-	LastActive time.Time `json:"last_active"`
+	Name        string        `json:"name"`
+	PID         int           `json:"pid"`
+	Command     []string      `json:"command"`
+	CreatedAt   time.Time     `json:"created_at"`
+	LastActive  time.Time     `json:"last_active"`
+	Dir         string        `json:"dir,omitempty"`          // Working directory the command was started in
+	ExitCode    *int          `json:"exit_code,omitempty"`    // Set once the command has exited
+	LogPath     string        `json:"log_path,omitempty"`     // Output log file, if logging is enabled
+	RecordPath  string        `json:"record_path,omitempty"`  // Timestamped output recording, if enabled
+	BufferPath  string        `json:"buffer_path,omitempty"`  // Snapshot of the replay buffer, if persisted
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty"` // Auto-shutdown after this long unused
+	ListenAddr  string        `json:"listen_addr,omitempty"`  // TCP address for remote clients, if enabled
+	Token       string        `json:"token,omitempty"`        // Shared secret clients must present (empty = no authentication)
+	Tags        []string      `json:"tags,omitempty"`         // User-defined labels for grouping sessions
+	Group       string        `json:"group,omitempty"`        // Sessions in a group can be listed and cleared together
+	Term        string        `json:"term,omitempty"`         // TERM the command was started with
+	ClientTerm  string        `json:"client_term,omitempty"`  // TERM of the most recently attached client
+	Restart     string        `json:"restart,omitempty"`      // Restart policy for the command (empty = never)
+	Restarts    int           `json:"restarts,omitempty"`     // How many times the command has been restarted
+	Rows        uint16        `json:"rows,omitempty"`         // Last known terminal size
+	Cols        uint16        `json:"cols,omitempty"`
+	PinnedRows  uint16        `json:"pinned_rows,omitempty"` // Fixed terminal size, whatever size clients have (0 = follow clients)
+	PinnedCols  uint16        `json:"pinned_cols,omitempty"`
 }
 
-// DataDir returns the directory for storing session data
+// Exited returns true if the session's command has exited
+func (s *Session) Exited() bool {
+	return s.ExitCode != nil
+}
+
+// exitedKeep is how long the info of a session whose command exited is
+// kept, so "tuck list" can show how it ended
+const exitedKeep = 24 * time.Hour
+
+// expired reports whether the session exited longer than exitedKeep ago
+// (the server saves LastActive when the command exits)
+func (s *Session) expired() bool {
+	return s.Exited() && time.Since(s.LastActive) > exitedKeep
+}
+
+// maxNameLen bounds session names, which end up in file and socket paths
+// (a Unix socket path can't be much over 100 bytes)
+const maxNameLen = 64
+
+// ValidateName checks that a session name can be used for its files:
+// it must not be empty or too long, start with a dot, or contain path
+// separators, colons (as in tcp:// addresses) or control characters
+func ValidateName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("empty session name")
+	case len(name) > maxNameLen:
+		return fmt.Errorf("invalid session name %q (longer than %d bytes)", name, maxNameLen)
+	case strings.HasPrefix(name, "."):
+		return fmt.Errorf("invalid session name %q (can't start with a dot)", name)
+	}
+	for _, r := range name {
+		if r == '/' || r == '\\' || r == ':' || unicode.IsControl(r) {
+			return fmt.Errorf("invalid session name %q (can't contain %q)", name, r)
+		}
+	}
+	return nil
+}
+
+// DataDir returns the directory for storing session data:
+// $TUCK_DATA_DIR, $XDG_DATA_HOME/tuck or ~/.local/share/tuck
 func DataDir() (string, error) {
+	if dir := os.Getenv("TUCK_DATA_DIR"); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "tuck"), nil
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("failed to get home directory: %w", err)
@@ -38,6 +108,31 @@ func EnsureDataDir() (string, error) {
 	return dir, nil
 }
 
+// CheckDataDir creates the data directory if needed and makes sure files
+// can be created in it, so a read-only or full file system is reported up
+// front rather than as some later failure. The directory is returned even
+// with an error if it is known.
+func CheckDataDir() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	if _, err := EnsureDataDir(); err != nil {
+		return dir, err
+	}
+	f, err := os.CreateTemp(dir, ".check-*")
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		return dir, fmt.Errorf("data directory is not writable: %s (%w)", dir, err)
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+	return dir, nil
+}
+
 // SocketPath returns the socket path for a session
 func SocketPath(name string) (string, error) {
 	dir, err := DataDir()
@@ -65,6 +160,47 @@ func ErrorPath(name string) (string, error) {
 	return filepath.Join(dir, name+".err"), nil
 }
 
+// ReadError returns the error a session's server left in its error file,
+// or "" if there is none
+func ReadError(name string) string {
+	path, err := ErrorPath(name)
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// LogPath returns the default output log path for a session
+func LogPath(name string) (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".log"), nil
+}
+
+// RecordPath returns the default output recording path for a session
+func RecordPath(name string) (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".rec"), nil
+}
+
+// BufferPath returns the default replay buffer snapshot path for a session
+func BufferPath(name string) (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".buf"), nil
+}
+
 // Save saves session info to disk
 func (s *Session) Save() error {
 	path, err := InfoPath(s.Name)
@@ -75,12 +211,36 @@ func (s *Session) Save() error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal session info: %w", err)
 	}
-	if err := os.WriteFile(path, data, 0600); err != nil {
+	// Load never sees a partly written file
+	if err := writeFileAtomic(path, data); err != nil {
 		return fmt.Errorf("failed to write session info: %w", err)
 	}
 	return nil
 }
 
+// writeFileAtomic writes a file by writing a temporary file next to it and
+// renaming that into place, so readers see either the old or the new data
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
 // Load loads session info from disk
 func Load(name string) (*Session, error) {
 	path, err := InfoPath(name)
@@ -98,8 +258,45 @@ func Load(name string) (*Session, error) {
 	return &s, nil
 }
 
-// Exists checks if a session exists
+// Exists checks if a session exists, i.e. its server is running.
+// A socket left behind by a crashed server (e.g. across a reboot) doesn't
+// count, and the dead session is cleaned up like List does.
 func Exists(name string) bool {
+	if !socketExists(name) {
+		return false
+	}
+	// Checking the server's PID is cheaper than connecting
+	if s, err := Load(name); err == nil && !s.Exited() {
+		if isProcessRunning(s.PID) {
+			return true
+		}
+		_ = Remove(name)
+		return false
+	}
+	// No info yet (the server is starting) or left over from an earlier session
+	return !staleSocket(name)
+}
+
+// Stale reports whether a session's socket was left behind by a server
+// that is no longer running
+func Stale(name string) bool {
+	return socketExists(name) && staleSocket(name)
+}
+
+// Dead reports whether a session's info says its command is running but
+// its server is gone (e.g. after a crash): its process isn't running, or
+// its PID has been reused but its socket refuses connections. Unlike
+// Exists, it leaves the session's files alone.
+func Dead(name string) bool {
+	s, err := Load(name)
+	if err != nil || s.Exited() {
+		return false
+	}
+	return !isProcessRunning(s.PID) || Stale(name)
+}
+
+// socketExists checks if a session's socket file exists
+func socketExists(name string) bool {
 	path, err := SocketPath(name)
 	if err != nil {
 		return false
@@ -108,6 +305,21 @@ func Exists(name string) bool {
 	return err == nil
 }
 
+// staleSocket reports whether connecting to a session's socket is refused,
+// which means nothing is listening on it any more
+func staleSocket(name string) bool {
+	path, err := SocketPath(name)
+	if err != nil {
+		return false
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return errors.Is(err, syscall.ECONNREFUSED)
+	}
+	_ = conn.Close()
+	return false
+}
+
 // List returns all sessions
 func List() ([]*Session, error) {
 	dir, err := DataDir()
@@ -133,6 +345,15 @@ func List() ([]*Session, error) {
 		if err != nil {
 			continue
 		}
+		// Keep exited sessions for a while so their exit code can be listed
+		if s.Exited() {
+			if s.expired() {
+				_ = Remove(name)
+				continue
+			}
+			sessions = append(sessions, s)
+			continue
+		}
 		// Check if the process is still running
 		if !isProcessRunning(s.PID) {
 			// Clean up stale session
@@ -144,35 +365,138 @@ func List() ([]*Session, error) {
 	return sessions, nil
 }
 
-// MostRecent returns the most recently active session
+// MostRecent returns the most recently active session that is still running.
+// Sessions active at the same time are ordered by name.
 func MostRecent() (*Session, error) {
 	sessions, err := List()
 	if err != nil {
 		return nil, err
 	}
-	if len(sessions) == 0 {
-		return nil, nil
-	}
-	most := sessions[0]
-	for _, s := range sessions[1:] {
-		if s.LastActive.After(most.LastActive) {
+	var most *Session
+	for _, s := range sessions {
+		if s.Exited() {
+			continue
+		}
+		if most == nil || s.LastActive.After(most.LastActive) ||
+			(s.LastActive.Equal(most.LastActive) && s.Name < most.Name) {
 			most = s
 		}
 	}
 	return most, nil
 }
 
-// Remove removes a session's files
+// Session orders for SortSessions
+const (
+	SortRecent  = "recent"  // Most recently active first
+	SortCreated = "created" // Most recently created first
+	SortName    = "name"    // Alphabetical
+)
+
+// SortSessions orders sessions in place (empty order = SortRecent).
+// Sessions that compare equal are ordered by name.
+func SortSessions(sessions []*Session, order string) error {
+	var cmp func(a, b *Session) int
+	switch order {
+	case "", SortRecent:
+		cmp = func(a, b *Session) int { return b.LastActive.Compare(a.LastActive) }
+	case SortCreated:
+		cmp = func(a, b *Session) int { return b.CreatedAt.Compare(a.CreatedAt) }
+	case SortName:
+		cmp = func(a, b *Session) int { return 0 }
+	default:
+		return fmt.Errorf("invalid sort order: %q (use recent, created or name)", order)
+	}
+	slices.SortFunc(sessions, func(a, b *Session) int {
+		if c := cmp(a, b); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return nil
+}
+
+// LogPaths returns the paths of a session's output log, recording, replay
+// buffer snapshot and debug logs, which Remove keeps. They are read from the
+// session's info, so ask before the info is removed.
+func LogPaths(name string) ([]string, error) {
+	logPath, err := LogPath(name)
+	if err != nil {
+		return nil, err
+	}
+	recordPath, err := RecordPath(name)
+	if err != nil {
+		return nil, err
+	}
+	bufferPath, err := BufferPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if s, err := Load(name); err == nil {
+		if s.LogPath != "" {
+			logPath = s.LogPath
+		}
+		if s.RecordPath != "" {
+			recordPath = s.RecordPath
+		}
+		if s.BufferPath != "" {
+			bufferPath = s.BufferPath
+		}
+	}
+	debugPath, err := DebugLogPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return []string{logPath, recordPath, bufferPath, debugPath, debugPath + ".1"}, nil
+}
+
+// RemoveLog removes a session's output log, recording and replay buffer
+// snapshot, which Remove keeps
+func RemoveLog(name string) error {
+	paths, err := LogPaths(name)
+	if err != nil {
+		return err
+	}
+	return RemoveLogFiles(paths)
+}
+
+// RemoveLogFiles removes log files given by LogPaths. Missing ones are skipped.
+func RemoveLogFiles(paths []string) error {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove log: %w", err)
+		}
+	}
+	return nil
+}
+
+// Remove removes a session's files (the output log is kept).
+// The lock goes too if it's held by the session's own server or a dead one,
+// but not if a new server for the name has just taken it.
 func Remove(name string) error {
 	sockPath, _ := SocketPath(name)
 	infoPath, _ := InfoPath(name)
 	errPath, _ := ErrorPath(name)
+	if lockPath, err := LockPath(name); err == nil {
+		pid, ok := lockHolder(lockPath)
+		s, err := Load(name)
+		if (ok && err == nil && pid == s.PID) || staleLock(lockPath) {
+			_ = os.Remove(lockPath)
+		}
+	}
 	_ = os.Remove(sockPath)
 	_ = os.Remove(infoPath)
 	_ = os.Remove(errPath)
 	return nil
 }
 
+// removeSocket removes a session's socket and error files, keeping the info file
+func removeSocket(name string) {
+	sockPath, _ := SocketPath(name)
+	errPath, _ := ErrorPath(name)
+	_ = os.Remove(sockPath)
+	_ = os.Remove(errPath)
+}
+
 // isProcessRunning checks if a process with the given PID is running
 func isProcessRunning(pid int) bool {
 	process, err := os.FindProcess(pid)
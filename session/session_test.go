@@ -0,0 +1,164 @@
+package session
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "work"},
+		{name: "my-project_2"},
+		{name: "feature.x"},
+		{name: "日本語"},
+		{name: strings.Repeat("a", maxNameLen)},
+		{name: "", wantErr: true},
+		{name: strings.Repeat("a", maxNameLen+1), wantErr: true},
+		{name: ".hidden", wantErr: true},
+		{name: "..", wantErr: true},
+		{name: "../evil", wantErr: true},
+		{name: "a/b", wantErr: true},
+		{name: `a\b`, wantErr: true},
+		{name: "tcp:host", wantErr: true},
+		{name: "a\nb", wantErr: true},
+		{name: "a\x1bb", wantErr: true},
+		{name: "a\x7fb", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateName(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDataDir(t *testing.T) {
+	home := t.TempDir()
+	tests := []struct {
+		name     string
+		dataDir  string
+		dataHome string
+		want     string
+	}{
+		{name: "TUCK_DATA_DIR first", dataDir: "/srv/tuck", dataHome: "/xdg", want: "/srv/tuck"},
+		{name: "XDG_DATA_HOME", dataHome: "/xdg", want: "/xdg/tuck"},
+		{name: "home", want: filepath.Join(home, ".local", "share", "tuck")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", home)
+			t.Setenv("TUCK_DATA_DIR", tt.dataDir)
+			t.Setenv("XDG_DATA_HOME", tt.dataHome)
+			got, err := DataDir()
+			if err != nil {
+				t.Fatalf("DataDir() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("DataDir() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathsFollowDataDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TUCK_DATA_DIR", dir)
+	tests := []struct {
+		name string
+		path func(string) (string, error)
+		want string
+	}{
+		{name: "SocketPath", path: SocketPath, want: "work.sock"},
+		{name: "InfoPath", path: InfoPath, want: "work.json"},
+		{name: "ErrorPath", path: ErrorPath, want: "work.err"},
+		{name: "LogPath", path: LogPath, want: "work.log"},
+		{name: "RecordPath", path: RecordPath, want: "work.rec"},
+		{name: "BufferPath", path: BufferPath, want: "work.buf"},
+		{name: "LockPath", path: LockPath, want: "work.lock"},
+		{name: "DebugLogPath", path: DebugLogPath, want: "work.debug.log"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.path("work")
+			if err != nil {
+				t.Fatalf("%s() error = %v", tt.name, err)
+			}
+			if want := filepath.Join(dir, tt.want); got != want {
+				t.Errorf("%s(\"work\") = %q, want %q", tt.name, got, want)
+			}
+		})
+	}
+}
+
+func TestSaveConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TUCK_DATA_DIR", dir)
+	if err := (&Session{Name: "busy"}).Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writers save info of different sizes, so a torn write would show
+	// up as JSON that doesn't parse or doesn't match any of them
+	const writers, saves = 8, 200
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range saves {
+				s := &Session{
+					Name:       "busy",
+					PID:        w,
+					Command:    []string{strings.Repeat("x", (w*saves+i)%4096)},
+					LastActive: time.Now(),
+				}
+				if err := s.Save(); err != nil {
+					t.Errorf("Save() error = %v", err)
+					return
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	loads := 0
+	for {
+		select {
+		case <-done:
+			if loads == 0 {
+				t.Error("no Load ran during the saves")
+			}
+			// Servers of other tests may still log events here, so
+			// only look for the temporary files
+			tmps, err := filepath.Glob(filepath.Join(dir, ".busy.json.*.tmp"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tmps) > 0 {
+				t.Errorf("temporary files left in the data directory: %v", tmps)
+			}
+			return
+		default:
+		}
+		s, err := Load("busy")
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if s.PID != 0 && len(s.Command) != 1 {
+			t.Fatalf("Load() = %+v, not a saved session", s)
+		}
+		loads++
+	}
+}
@@ -0,0 +1,57 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Status is a running session's live state, as reported by its server
+type Status struct {
+	Name       string    `json:"name"`
+	PID        int       `json:"pid"`
+	Clients    int       `json:"clients"` // Attached terminals
+	Rows       uint16    `json:"rows"`    // Current terminal size (0 until a client has attached)
+	Cols       uint16    `json:"cols"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastActive time.Time `json:"last_active"`
+	Cwd        string    `json:"cwd,omitempty"` // Directory the shell last reported (OSC 7), or the one the command started in
+}
+
+// Query asks a running session's server for its live state
+func Query(name string) (*Status, error) {
+	if !IsRemote(name) && !Exists(name) {
+		return nil, fmt.Errorf("session %q does not exist", name)
+	}
+	conn, err := dial(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	// Output isn't needed, only the reply
+	if _, _, err := handshake(conn, HelloReplayNone, clientToken(name)); err != nil {
+		return nil, err
+	}
+	// Servers that don't know MsgQuery ignore it
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := writeMessage(conn, MsgQuery, nil); err != nil {
+		return nil, fmt.Errorf("failed to send query: %w", err)
+	}
+
+	// Skip live output until the server replies
+	for {
+		msgType, data, err := readMessage(conn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read query reply: %w", err)
+		}
+		if msgType != MsgQuery {
+			continue
+		}
+		var st Status
+		if err := json.Unmarshal(data, &st); err != nil {
+			return nil, fmt.Errorf("invalid query reply: %w", err)
+		}
+		return &st, nil
+	}
+}
@@ -0,0 +1,74 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// generateToken returns a random shared secret for authenticating clients
+func generateToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// checkToken compares a presented token in constant time
+func checkToken(want, got string) bool {
+	return subtle.ConstantTimeCompare([]byte(want), []byte(got)) == 1
+}
+
+// splitRemote splits "tcp://[token@]host:port" into its address and token
+func splitRemote(name string) (addr, token string) {
+	addr = strings.TrimPrefix(name, "tcp://")
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		return addr[i+1:], addr[:i]
+	}
+	return addr, ""
+}
+
+// DisplayName returns a session name suitable for showing on screen,
+// with any token in a remote address left out
+func DisplayName(name string) string {
+	if !IsRemote(name) {
+		return name
+	}
+	addr, _ := splitRemote(name)
+	return "tcp://" + addr
+}
+
+// clientToken returns the token to present when connecting to a session.
+// Local sessions keep it in their info file; remote ones take it from the
+// address or $TUCK_TOKEN.
+func clientToken(name string) string {
+	if IsRemote(name) {
+		if _, token := splitRemote(name); token != "" {
+			return token
+		}
+		return os.Getenv("TUCK_TOKEN")
+	}
+	if s, err := Load(name); err == nil {
+		return s.Token
+	}
+	return ""
+}
+
+// socketToken returns the token to present when connecting to a socket by
+// path. The session's info file is looked for next to it, as tuck keeps them
+// together; otherwise $TUCK_TOKEN is used.
+func socketToken(path string) string {
+	data, err := os.ReadFile(strings.TrimSuffix(path, ".sock") + ".json")
+	if err == nil {
+		var s Session
+		if json.Unmarshal(data, &s) == nil && s.Token != "" {
+			return s.Token
+		}
+	}
+	return os.Getenv("TUCK_TOKEN")
+}